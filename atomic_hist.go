@@ -0,0 +1,188 @@
+package hdrhist
+
+import (
+	"sync/atomic"
+)
+
+// AtomicHist is a Hist that is safe for concurrent use.
+//
+// Recording values is lock-free: counts are updated with atomic operations.
+// If AutoResize is enabled and a value too large to be recorded arrives,
+// the recording goroutine resizes the histogram and concurrent writers
+// proceed once the new counts are in place.
+//
+// Statistics are obtained by taking a Snapshot,
+// which produces an ordinary Hist.
+type AtomicHist struct {
+	totalCount int64 // accessed atomically, keep 64-bit aligned
+
+	counts atomic.Value // []int64
+	b      buckets      // b.counts is unused
+	cfg    Config
+
+	p *phaser
+}
+
+// NewAtomicHist creates a new AtomicHist that auto-resizes
+// and has a LowestDiscernible value of 1.
+// Valid values for sigfigs are between 0 and 5.
+func NewAtomicHist(sigfigs int32) *AtomicHist {
+	return NewAtomicHistWithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  2,
+		SigFigs:           sigfigs,
+		AutoResize:        true,
+	})
+}
+
+// NewAtomicHistWithConfig creates a new AtomicHist with the provided Config.
+func NewAtomicHistWithConfig(cfg Config) *AtomicHist {
+	var h AtomicHist
+	h.Init(cfg)
+	return &h
+}
+
+// Init initializes the AtomicHist with the given Config.
+// Init must not be called concurrently with any other method.
+func (h *AtomicHist) Init(cfg Config) {
+	var tmp Hist
+	tmp.Init(cfg)
+	h.totalCount = 0
+	h.counts.Store(tmp.b.counts)
+	h.b = tmp.b
+	h.b.counts = nil
+	h.cfg = tmp.cfg
+	h.p = newPhaser()
+}
+
+func (h *AtomicHist) loadCounts() []int64 {
+	return h.counts.Load().([]int64)
+}
+
+func (h *AtomicHist) Record(v int64) { h.RecordN(v, 1) }
+
+func (h *AtomicHist) RecordN(v, count int64) {
+	i := h.b.countsIndex(v)
+	for {
+		critVal := h.p.writerEnter()
+		counts := h.loadCounts()
+		if 0 <= i && i < len(counts) {
+			atomic.AddInt64(&counts[i], count)
+			atomic.AddInt64(&h.totalCount, count)
+			h.p.writerExit(critVal)
+			return
+		}
+		h.p.writerExit(critVal)
+
+		if i < 0 || !h.cfg.AutoResize {
+			panic("value too large")
+		}
+		h.resize(v)
+	}
+}
+
+func (h *AtomicHist) RecordCorrected(v int64, expectedInterval int64) {
+	h.RecordN(v, 1)
+	missing := v - expectedInterval
+	for missing >= expectedInterval {
+		h.RecordN(missing, 1)
+		missing -= expectedInterval
+	}
+}
+
+// resize grows the counts so that v can be recorded.
+//
+// Writers may continue to record into the old counts until
+// the phase flip completes, after which the old counts
+// are folded into the new ones.
+func (h *AtomicHist) resize(v int64) {
+	h.p.readerLock()
+	defer h.p.readerUnlock()
+
+	old := h.loadCounts()
+	if h.b.countsIndex(v) < len(old) {
+		// resized by another writer
+		return
+	}
+
+	bucketCount := numBucketsToCoverVal(v, h.b.subCount, h.b.unitMag)
+	countsLen := int(bucketCount+1) * int(h.b.subCount/2)
+	counts := make([]int64, countsLen)
+	h.counts.Store(counts)
+	h.p.flipPhase()
+
+	for i := range old {
+		if c := atomic.LoadInt64(&old[i]); c != 0 {
+			atomic.AddInt64(&counts[i], c)
+		}
+	}
+	h.b.bucketCount = bucketCount
+	h.cfg.HighestTrackable = h.b.highestEquiv(h.b.valueFor(countsLen - 1))
+}
+
+// TotalCount returns the number of values recorded so far.
+func (h *AtomicHist) TotalCount() int64 { return atomic.LoadInt64(&h.totalCount) }
+
+// Config returns the current Config of the histogram.
+// HighestTrackable will reflect any resizing that has occurred.
+func (h *AtomicHist) Config() Config {
+	h.p.readerLock()
+	defer h.p.readerUnlock()
+	return h.cfg
+}
+
+// Snapshot copies the recorded values into dst and returns it.
+// If dst is nil, a new Hist is allocated.
+// The counts slice of dst is reused if it has sufficient capacity.
+//
+// Values recorded concurrently with Snapshot may or may not be included,
+// but the total count of the returned Hist always matches its counts.
+// The start and end times and the tag of dst are cleared.
+func (h *AtomicHist) Snapshot(dst *Hist) *Hist {
+	if dst == nil {
+		dst = &Hist{}
+	}
+
+	h.p.readerLock()
+	defer h.p.readerUnlock()
+
+	src := h.loadCounts()
+	counts := dst.b.counts
+	if cap(counts) < len(src) {
+		counts = make([]int64, len(src))
+	}
+	counts = counts[:len(src)]
+
+	var total int64
+	for i := range src {
+		c := atomic.LoadInt64(&src[i])
+		counts[i] = c
+		total += c
+	}
+
+	dst.b = h.b
+	dst.b.counts = counts
+	dst.cfg = h.cfg
+	dst.totalCount = total
+	dst.startTime = optTime{}
+	dst.endTime = optTime{}
+	dst.tag = ""
+	dst.normalizingIndexOff = 0
+	dst.f64Ratio = 0
+	dst.statsFromBuckets()
+	return dst
+}
+
+// Clear deletes all recorded values.
+// Values recorded concurrently with Clear may or may not be retained.
+func (h *AtomicHist) Clear() {
+	h.p.readerLock()
+	defer h.p.readerUnlock()
+
+	counts := h.loadCounts()
+	for i := range counts {
+		if c := atomic.SwapInt64(&counts[i], 0); c != 0 {
+			atomic.AddInt64(&h.totalCount, -c)
+		}
+	}
+}
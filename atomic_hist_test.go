@@ -0,0 +1,78 @@
+package hdrhist
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAtomicHistMatchesHist(t *testing.T) {
+	const (
+		writers   = 8
+		perWriter = 10000
+	)
+
+	ah := NewAtomicHist(3)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				// large values force resizing while other writers are active
+				ah.Record(int64(i) << uint(w*4))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	want := New(3)
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			want.Record(int64(i) << uint(w*4))
+		}
+	}
+
+	got := ah.Snapshot(nil)
+	if got.TotalCount() != want.TotalCount() {
+		t.Fatalf("total count: want %d got %d", want.TotalCount(), got.TotalCount())
+	}
+	if c := ah.TotalCount(); c != want.TotalCount() {
+		t.Errorf("atomic total count: want %d got %d", want.TotalCount(), c)
+	}
+	for _, p := range []float64{0, 10, 50, 90, 99, 99.9, 100} {
+		if g, w := got.PercentileVal(p), want.PercentileVal(p); g != w {
+			t.Errorf("P%v: want %+v got %+v", p, w, g)
+		}
+	}
+}
+
+func TestAtomicHistSnapshotReuse(t *testing.T) {
+	ah := NewAtomicHistWithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           2,
+	})
+	ah.Record(10)
+	ah.RecordN(1000, 3)
+
+	h := ah.Snapshot(nil)
+	counts := h.b.counts
+	ah.Clear()
+	if c := ah.TotalCount(); c != 0 {
+		t.Errorf("total count after clear: want 0 got %d", c)
+	}
+	ah.Record(20)
+	h = ah.Snapshot(h)
+	if &h.b.counts[0] != &counts[0] {
+		t.Error("snapshot did not reuse counts")
+	}
+	if c := h.TotalCount(); c != 1 {
+		t.Errorf("total count: want 1 got %d", c)
+	}
+	if c := h.Val(20).Count; c != 1 {
+		t.Errorf("Val(20).Count: want 1 got %d", c)
+	}
+	if !doesPanic(func() { ah.Record(1e9) }) {
+		t.Error("want panic when recording too high val")
+	}
+}
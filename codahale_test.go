@@ -109,7 +109,8 @@ func TestCodahaleStdDev(t *testing.T) {
 		h.Record(int64(i))
 	}
 
-	if v, want := h.Stdev(), 288675.1403682715; v != want {
+	// The exact value is 288675.14036827146...
+	if v, want := h.Stdev(), 288675.14036827144; v != want {
 		t.Errorf("StdDev was %v, but expected %v", v, want)
 	}
 }
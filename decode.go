@@ -2,9 +2,10 @@ package hdrhist
 
 import (
 	"bytes"
-	"compress/zlib"
+	"compress/flate"
 	"encoding/binary"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"math"
 
 	"github.com/pkg/errors"
@@ -26,18 +27,170 @@ const (
 	encodingV0HeaderSize = 32
 )
 
-func decodeCompressed(h *Hist, buf []byte) error {
-	const doubleHistCookie = 0x0c72124e
-	const doubleHistCompressedCookie = 0x0c72124f
+const (
+	doubleHistCookie           = 0x0c72124e
+	doubleHistCompressedCookie = 0x0c72124f
+
+	doubleHistHeaderSize = 12
+)
+
+// histHeader contains the header fields of an encoded histogram.
+type histHeader struct {
+	cookie                  int32
+	payloadLen              int32
+	normalizingIndexOff     int32
+	sigfigs                 int32
+	lowestDiscernible       int64
+	highestTrackable        int64
+	intToF64ConversionRatio float64
+}
+
+// DecodeOptions limits the resources used to decode a histogram.
+// A zero field means that no limit is applied beyond the sizes
+// implied by the histogram's header.
+type DecodeOptions struct {
+	// MaxCountsLen is the maximum number of counts a decoded histogram
+	// may have. It bounds the memory used by the histogram.
+	MaxCountsLen int
+
+	// MaxDecompressedBytes is the maximum size of the uncompressed
+	// encoding of a histogram, including its header.
+	MaxDecompressedBytes int
+
+	// MaxTotalCount is the maximum total count of a decoded histogram.
+	MaxTotalCount int64
+}
+
+// A DecodeError is returned when an encoded histogram is malformed.
+type DecodeError struct {
+	Msg string
+	Err error // underlying error, may be nil
+}
 
-	r := bytes.NewReader(buf)
-	var cookie int32
-	if err := binary.Read(r, binary.BigEndian, &cookie); err != nil {
-		return errors.Wrap(err, "unable to decode cookie")
+func (e *DecodeError) Error() string {
+	if e.Err == nil {
+		return "hdrhist: " + e.Msg
 	}
+	return "hdrhist: " + e.Msg + ": " + e.Err.Error()
+}
 
-	if cookie == doubleHistCookie || cookie == doubleHistCompressedCookie {
-		return errors.New("double histograms are unsupported")
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// A LimitError is returned when decoding a histogram
+// would exceed one of the limits in DecodeOptions.
+type LimitError struct {
+	Limit string // name of the DecodeOptions field
+	Max   int64
+	Value int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("hdrhist: %s exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+func malformed(msg string) error {
+	return &DecodeError{Msg: msg}
+}
+
+func malformedf(format string, args ...interface{}) error {
+	return &DecodeError{Msg: fmt.Sprintf(format, args...)}
+}
+
+func wrapMalformed(err error, msg string) error {
+	return &DecodeError{Msg: msg, Err: err}
+}
+
+// decoder decodes histograms subject to opts.
+// Its buffers and decompressor are reused between histograms.
+type decoder struct {
+	opts DecodeOptions
+
+	br     bytes.Reader
+	zr     io.ReadCloser // implements flate.Resetter once created
+	header [encodingHeaderSize]byte
+	buf    []byte
+	b64    []byte // used by decodeEntry
+}
+
+// resetZlib points d.zr at the zlib stream in d.br.
+//
+// The zlib header is parsed here so that a single flate reader can be
+// reused: resetting a zlib reader allocates a new checksum each time.
+// Like the zlib reader when the stream is not read to its end,
+// the trailing checksum is not verified.
+func (d *decoder) resetZlib() error {
+	if d.br.Len() < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	cmf, _ := d.br.ReadByte()
+	flg, _ := d.br.ReadByte()
+	if cmf&0x0f != 8 || (uint16(cmf)<<8|uint16(flg))%31 != 0 {
+		return errors.New("invalid zlib header")
+	}
+	if flg&0x20 != 0 {
+		return errors.New("zlib dictionaries are not supported")
+	}
+	if d.zr == nil {
+		d.zr = flate.NewReader(&d.br)
+		return nil
+	}
+	return d.zr.(flate.Resetter).Reset(&d.br, nil)
+}
+
+// payloadBuf returns a buffer of n bytes that is reused between calls.
+func (d *decoder) payloadBuf(n int) []byte {
+	if cap(d.buf) < n {
+		d.buf = make([]byte, n)
+	}
+	return d.buf[:n]
+}
+
+// checkDecompressed checks that an uncompressed encoding
+// of n bytes is within MaxDecompressedBytes.
+func (d *decoder) checkDecompressed(n int) error {
+	if d.opts.MaxDecompressedBytes > 0 && n > d.opts.MaxDecompressedBytes {
+		return &LimitError{"MaxDecompressedBytes", int64(d.opts.MaxDecompressedBytes), int64(n)}
+	}
+	return nil
+}
+
+// decodeBuf decodes a compressed or uncompressed histogram from buf.
+func (d *decoder) decodeBuf(h *Hist, buf []byte) (histHeader, error) {
+	if len(buf) < 4 {
+		return histHeader{}, malformed("buffer does not contain cookie")
+	}
+	cookie := int32(binary.BigEndian.Uint32(buf))
+	var headerSize int
+	switch cookie & ^0xf0 {
+	case encodingV1CookieBase, encodingV2CookieBase:
+		headerSize = encodingHeaderSize
+	case encodingV0CookieBase:
+		headerSize = encodingV0HeaderSize
+	default:
+		return d.decodeCompressed(h, buf)
+	}
+	if len(buf) < headerSize {
+		return histHeader{}, malformed("buffer does not contain histogram header")
+	}
+	hdr, err := d.decodeHeader(h, buf[:headerSize])
+	if err != nil {
+		return hdr, err
+	}
+	if cookie & ^0xf0 != encodingV0CookieBase {
+		if err := d.checkDecompressed(headerSize + int(hdr.payloadLen)); err != nil {
+			return hdr, err
+		}
+	}
+	return hdr, d.decodePayload(h, &hdr, buf[headerSize:])
+}
+
+func (d *decoder) decodeCompressed(h *Hist, buf []byte) (histHeader, error) {
+	if len(buf) < 8 {
+		return histHeader{}, malformed("buffer does not contain compressed hist header")
+	}
+	cookie := int32(binary.BigEndian.Uint32(buf))
+	if isDoubleHistCookie(cookie) {
+		return histHeader{}, malformed("double histograms must be decoded as a DoubleHist")
 	}
 
 	var headerSize int
@@ -47,90 +200,214 @@ func decodeCompressed(h *Hist, buf []byte) error {
 	case compressedEncodingV0CookieBase:
 		headerSize = encodingV0HeaderSize
 	default:
-		return errors.New("no histogram in buffer")
+		return histHeader{}, malformed("no histogram in buffer")
 	}
-	var compressedLen int32
-	if err := binary.Read(r, binary.BigEndian, &compressedLen); err != nil {
-		return errors.Wrap(err, "unable decode length")
+	compressedLen := int32(binary.BigEndian.Uint32(buf[4:]))
+	if compressedLen < 0 || int(compressedLen) > len(buf)-8 {
+		return histHeader{}, malformed("buffer does not contain full compressed hist")
 	}
-	zr, err := zlib.NewReader(bytes.NewReader(buf[8 : 8+compressedLen]))
+	d.br.Reset(buf[8 : 8+compressedLen])
+	if err := d.resetZlib(); err != nil {
+		return histHeader{}, wrapMalformed(err, "can't create decompressor")
+	}
+
+	// The decompressed size is never trusted: the header is read first
+	// so that the payload can be limited to what the counts can hold.
+	headerBuf := d.header[:headerSize]
+	if _, err := io.ReadFull(d.zr, headerBuf); err != nil {
+		return histHeader{}, wrapMalformed(err, "decompressed hist does not contain header")
+	}
+	hdr, err := d.decodeHeader(h, headerBuf)
 	if err != nil {
-		return errors.Wrap(err, "can't create decompressor")
+		return hdr, err
+	}
+
+	maxPayload := maxPayloadLen(len(h.b.counts), hdr.cookie)
+	limited := d.opts.MaxDecompressedBytes > 0 && d.opts.MaxDecompressedBytes-headerSize < maxPayload
+	if limited {
+		maxPayload = d.opts.MaxDecompressedBytes - headerSize
+	}
+	var payload []byte
+	if cookie & ^0xf0 == compressedEncodingV0CookieBase {
+		// V0 payloads extend to the end of the compressed data
+		if maxPayload < 0 {
+			maxPayload = 0
+		}
+		payload = d.payloadBuf(maxPayload + 1)
+		var n int
+		n, err = io.ReadFull(d.zr, payload)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			err = nil
+		}
+		payload = payload[:n]
+		if len(payload) > maxPayload {
+			if limited {
+				return hdr, &LimitError{"MaxDecompressedBytes", int64(d.opts.MaxDecompressedBytes), int64(headerSize + len(payload))}
+			}
+			payload = payload[:maxPayload]
+		}
+	} else {
+		if int(hdr.payloadLen) > maxPayload {
+			if limited {
+				return hdr, &LimitError{"MaxDecompressedBytes", int64(d.opts.MaxDecompressedBytes), int64(headerSize) + int64(hdr.payloadLen)}
+			}
+			return hdr, malformedf("payload size %d exceeds size of %d counts", hdr.payloadLen, len(h.b.counts))
+		}
+		payload = d.payloadBuf(int(hdr.payloadLen))
+		_, err = io.ReadFull(d.zr, payload)
 	}
-	b, err := ioutil.ReadAll(zr)
-	zr.Close()
 	if err != nil {
-		return errors.Wrap(err, "unable to decompress encoded hist")
+		return hdr, wrapMalformed(err, "unable to decompress encoded hist")
 	}
+	return hdr, d.decodePayload(h, &hdr, payload)
+}
 
-	return decode(h, b[:headerSize], b[headerSize:])
+// maxPayloadLen returns the largest payload that can encode
+// countsLen counts using the encoding of cookie.
+func maxPayloadLen(countsLen int, cookie int32) int {
+	wordSize := wordByteCountFromCookie(cookie)
+	if wordSize < 0 {
+		wordSize = encodingV2maxWordSize
+	}
+	return countsLen * wordSize
 }
 
-func decode(h *Hist, headerBuf, buf []byte) error {
-	hr := bytes.NewReader(headerBuf)
-	var cookie int32
-	if err := binary.Read(hr, binary.BigEndian, &cookie); err != nil {
-		return errors.Wrap(err, "unable to read cookie")
+// decodeHeader decodes an uncompressed header from headerBuf
+// and initializes h to match it.
+func (d *decoder) decodeHeader(h *Hist, headerBuf []byte) (histHeader, error) {
+	hdr, err := parseHeader(headerBuf)
+	if err != nil {
+		return hdr, err
 	}
-	var (
-		payloadLen              int32
-		normalizingIndexOff     int32 // ignored
-		sigfigs                 int32
-		lowestDiscernible       int64
-		highestTrackable        int64
-		intToF64ConversionRatio float64 // ignored
-	)
-	switch cookie & ^0xf0 {
+	if err := d.initHist(h, hdr.config()); err != nil {
+		return hdr, err
+	}
+
+	// HdrHistogram rotates its counts array by the normalizing index offset
+	// after shifting values, but encodes counts in normalized
+	// (i.e. logical) order. Since Hist does not rotate its counts,
+	// the payload can be read as is and the offset is only retained
+	// so that it can be written back when encoding.
+	// Offsets that don't fit in the counts array can't have been
+	// produced by HdrHistogram.
+	if off := int(hdr.normalizingIndexOff); off <= -len(h.b.counts) || len(h.b.counts) <= off {
+		return hdr, malformedf("normalizing index offset %d out of range for %d counts", off, len(h.b.counts))
+	}
+	h.normalizingIndexOff = hdr.normalizingIndexOff
+	if hdr.intToF64ConversionRatio != 1 {
+		h.f64Ratio = hdr.intToF64ConversionRatio
+	}
+	return hdr, nil
+}
+
+// parseHeader parses and checks the histogram header in headerBuf.
+func parseHeader(headerBuf []byte) (histHeader, error) {
+	var hdr histHeader
+	if len(headerBuf) < 4 {
+		return hdr, malformed("unable to read cookie")
+	}
+	hdr.cookie = int32(binary.BigEndian.Uint32(headerBuf))
+	switch hdr.cookie & ^0xf0 {
 	case encodingV1CookieBase, encodingV2CookieBase:
-		vals := []struct {
-			dest interface{}
-			name string
-		}{
-			{&payloadLen, "payload size"},
-			{&normalizingIndexOff, "normalizing index offset"},
-			{&sigfigs, "sigfig count"},
-			{&lowestDiscernible, "lowest discernible value"},
-			{&highestTrackable, "highest trackable value"},
-			{&intToF64ConversionRatio, "int to double conversion ratio"},
-		}
-		for _, v := range vals {
-			if err := binary.Read(hr, binary.BigEndian, v.dest); err != nil {
-				return errors.Wrapf(err, "unable to read %s", v.name)
-			}
+		if len(headerBuf) < encodingHeaderSize {
+			return hdr, malformed("header too short")
+		}
+		hdr.payloadLen = int32(binary.BigEndian.Uint32(headerBuf[4:]))
+		hdr.normalizingIndexOff = int32(binary.BigEndian.Uint32(headerBuf[8:]))
+		hdr.sigfigs = int32(binary.BigEndian.Uint32(headerBuf[12:]))
+		hdr.lowestDiscernible = int64(binary.BigEndian.Uint64(headerBuf[16:]))
+		hdr.highestTrackable = int64(binary.BigEndian.Uint64(headerBuf[24:]))
+		hdr.intToF64ConversionRatio = math.Float64frombits(binary.BigEndian.Uint64(headerBuf[32:]))
+		if hdr.payloadLen < 0 {
+			return hdr, malformedf("invalid payload size %d", hdr.payloadLen)
 		}
 	case encodingV0CookieBase:
-		return errors.New("v0 encoding not supported")
+		// V0 headers have no payload length, normalizing index offset,
+		// or conversion ratio but do contain a total count,
+		// which is ignored and recomputed from the counts.
+		if len(headerBuf) < encodingV0HeaderSize {
+			return hdr, malformed("header too short")
+		}
+		hdr.sigfigs = int32(binary.BigEndian.Uint32(headerBuf[4:]))
+		hdr.lowestDiscernible = int64(binary.BigEndian.Uint64(headerBuf[8:]))
+		hdr.highestTrackable = int64(binary.BigEndian.Uint64(headerBuf[16:]))
+		hdr.intToF64ConversionRatio = 1
 	default:
-		return errors.New("no valid cookie found")
+		return hdr, malformed("no valid cookie found")
 	}
-	h.Init(Config{
-		LowestDiscernible: lowestDiscernible,
-		HighestTrackable:  highestTrackable,
-		SigFigs:           sigfigs,
-	})
-	h.Clear()
-
-	// TODO: consider handling uncompressed histograms where
-	//       headerBuf contains the full data and buf is nil
+	if !validConversionRatio(hdr.intToF64ConversionRatio) {
+		return hdr, malformedf("invalid int to double conversion ratio %v", hdr.intToF64ConversionRatio)
+	}
+	return hdr, nil
+}
 
-	if int(payloadLen) > len(buf) {
-		return errors.New("buffer does not contain full payload")
+// config returns the Config of the histogram described by hdr.
+func (hdr *histHeader) config() Config {
+	return Config{
+		LowestDiscernible: hdr.lowestDiscernible,
+		HighestTrackable:  hdr.highestTrackable,
+		SigFigs:           hdr.sigfigs,
 	}
+}
 
-	_, err := fillCountsFromBuf(h, buf, int(payloadLen), cookie)
-	if err != nil {
+// initHist resets h and initializes it with cfg
+// if cfg is valid and within the limits of d.
+// The counts of h are reused if they are large enough.
+func (d *decoder) initHist(h *Hist, cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return wrapMalformed(err, "invalid header")
+	}
+	if err := d.checkCountsLen(cfg); err != nil {
 		return err
 	}
+	counts := h.b.counts
+	*h = Hist{}
+	h.initCounts(cfg, counts)
+	return nil
+}
 
+// checkCountsLen checks that a Hist with the valid cfg
+// would have no more than MaxCountsLen counts.
+func (d *decoder) checkCountsLen(cfg Config) error {
+	b := cfg.layout()
+	if n := b.countsLen(); d.opts.MaxCountsLen > 0 && n > d.opts.MaxCountsLen {
+		return &LimitError{"MaxCountsLen", int64(d.opts.MaxCountsLen), int64(n)}
+	}
 	return nil
 }
 
-func fillCountsFromBuf(h *Hist, buf []byte, payloadLen int, cookie int32) (int, error) {
+// decodePayload fills the counts of h, which must have been
+// initialized by decodeHeader, from the payload in buf.
+func (d *decoder) decodePayload(h *Hist, hdr *histHeader, buf []byte) error {
+	if hdr.cookie & ^0xf0 == encodingV0CookieBase {
+		// the V0 payload extends to the end of the buffer
+		// but never contains more than the full counts
+		wordSize := wordByteCountFromCookie(hdr.cookie)
+		n := len(h.b.counts) * wordSize
+		if n > len(buf) {
+			n = len(buf)
+		}
+		if wordSize > 0 {
+			n -= n % wordSize
+		}
+		hdr.payloadLen = int32(n)
+	}
+
+	if int(hdr.payloadLen) > len(buf) {
+		return malformed("buffer does not contain full payload")
+	}
+	return d.fillCounts(h, buf[:hdr.payloadLen], hdr.cookie)
+}
+
+func (d *decoder) fillCounts(h *Hist, buf []byte, cookie int32) error {
 	desti := 0
 	pos := 0
 	wordSize := wordByteCountFromCookie(cookie)
-	for pos < payloadLen {
-		var zerosCount int32
+	if wordSize == 0 {
+		return malformed("invalid word size")
+	}
+	for pos < len(buf) {
+		var zerosCount int64
 		var count int64
 
 		switch {
@@ -140,33 +417,48 @@ func fillCountsFromBuf(h *Hist, buf []byte, payloadLen int, cookie int32) (int,
 			count, clen, err = decodeZigZag(buf[pos:])
 			pos += clen
 			if err != nil {
-				return 0, errors.Wrap(err, "invalid count")
+				return wrapMalformed(err, "invalid count")
 			}
 			if count < 0 {
-				zc := -count
-				if zc > math.MaxInt32 {
-					return 0, errors.New("got zero count > math.MaxInt32")
+				zerosCount = -count
+				if zerosCount > math.MaxInt32 || zerosCount < 0 {
+					return malformed("got zero count > math.MaxInt32")
 				}
-				zerosCount = int32(zc)
 			}
 		default:
 			var err error
 			count, err = decodeIntSize(buf[pos:], wordSize)
 			if err != nil {
-				return 0, errors.Wrap(err, "counts not written correctly")
+				return wrapMalformed(err, "counts not written correctly")
 			}
 			pos += wordSize
+			if count < 0 {
+				return malformedf("negative count %d", count)
+			}
 		}
 
 		if zerosCount > 0 {
+			if zerosCount > int64(len(h.b.counts)-desti) {
+				return malformedf("zero run of %d exceeds %d counts", zerosCount, len(h.b.counts))
+			}
 			desti += int(zerosCount)
-		} else {
-			h.b.counts[desti] = count
-			h.totalCount += count
-			desti++
+			continue
+		}
+		if desti >= len(h.b.counts) {
+			return malformedf("payload contains more than %d counts", len(h.b.counts))
+		}
+		if h.totalCount > math.MaxInt64-count {
+			return malformed("total count overflows int64")
+		}
+		h.b.counts[desti] = count
+		h.totalCount += count
+		desti++
+		if d.opts.MaxTotalCount > 0 && h.totalCount > d.opts.MaxTotalCount {
+			return &LimitError{"MaxTotalCount", d.opts.MaxTotalCount, h.totalCount}
 		}
 	}
-	return desti, nil
+	h.statsFromBuckets()
+	return nil
 }
 
 func wordByteCountFromCookie(cookie int32) int {
@@ -205,4 +497,38 @@ func decodeIntSize(buf []byte, size int) (int64, error) {
 		}
 		return res, nil
 	}
-}
\ No newline at end of file
+}
+
+func isDoubleHistCookie(cookie int32) bool {
+	return cookie == doubleHistCookie || cookie == doubleHistCompressedCookie
+}
+
+// decodeDouble decodes a DoubleHist encoded with
+// either of the double histogram cookies.
+func (dec *decoder) decodeDouble(d *DoubleHist, buf []byte) error {
+	if len(buf) < doubleHistHeaderSize {
+		return malformed("buffer does not contain double histogram header")
+	}
+	cookie := int32(binary.BigEndian.Uint32(buf))
+	ratio := int64(binary.BigEndian.Uint64(buf[4:]))
+	buf = buf[doubleHistHeaderSize:]
+
+	if !isDoubleHistCookie(cookie) {
+		return malformed("no double histogram in buffer")
+	}
+	var h Hist
+	if _, err := dec.decodeBuf(&h, buf); err != nil {
+		return errors.Wrap(err, "unable to decode integer values")
+	}
+	if err := checkDoubleConfig(ratio, h.cfg.SigFigs); err != nil {
+		return wrapMalformed(err, "invalid double histogram header")
+	}
+	cfg, _, _ := doubleIntConfig(ratio, h.cfg.SigFigs)
+	if err := dec.checkCountsLen(cfg); err != nil {
+		return err
+	}
+	if err := d.initFromInt(ratio, &h); err != nil {
+		return wrapMalformed(err, "invalid double histogram")
+	}
+	return nil
+}
@@ -1,6 +1,16 @@
 package hdrhist
 
-import "testing"
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
 
 func TestUtil_decodeIntSize(t *testing.T) {
 	tests := []struct {
@@ -38,3 +48,416 @@ func TestUtil_decodeIntSize(t *testing.T) {
 		}
 	}
 }
+
+// encodeV1 encodes h in the uncompressed V1 format
+// with the given word size.
+func encodeV1(h *Hist, wordSize int) []byte {
+	var payload bytes.Buffer
+	n := h.b.countsIndex(h.Max()) + 1
+	word := make([]byte, 8)
+	for _, c := range h.b.counts[:n] {
+		binary.BigEndian.PutUint64(word, uint64(c))
+		payload.Write(word[8-wordSize:])
+	}
+
+	var buf bytes.Buffer
+	cfg := h.Config()
+	binary.Write(&buf, binary.BigEndian, int32(encodingV1CookieBase|wordSize<<4))
+	binary.Write(&buf, binary.BigEndian, int32(payload.Len()))
+	binary.Write(&buf, binary.BigEndian, int32(0))
+	binary.Write(&buf, binary.BigEndian, cfg.SigFigs)
+	binary.Write(&buf, binary.BigEndian, cfg.LowestDiscernible)
+	binary.Write(&buf, binary.BigEndian, cfg.HighestTrackable)
+	binary.Write(&buf, binary.BigEndian, float64(1))
+	payload.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+func TestDecodeUncompressed(t *testing.T) {
+	h := WithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e6,
+		SigFigs:           3,
+	})
+	h.RecordN(1, 3)
+	h.RecordN(1000, 2)
+	h.Record(1e5)
+
+	var v2 bytes.Buffer
+	if err := h.Encode(&v2, false); err != nil {
+		t.Fatalf("unable to encode: %v", err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"v1 (2 byte words)", encodeV1(h, 2)},
+		{"v1 (4 byte words)", encodeV1(h, 4)},
+		{"v1 (8 byte words)", encodeV1(h, 8)},
+		{"v2", v2.Bytes()},
+	}
+	for _, test := range tests {
+		var got Hist
+		if err := got.UnmarshalBinary(test.data); err != nil {
+			t.Errorf("%s: unable to decode: %v", test.name, err)
+			continue
+		}
+		if err := sameHistsNoTime(h, &got); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+
+		line := "0.000,1.000,0.100," + base64.StdEncoding.EncodeToString(test.data) + "\n"
+		r := NewLogReader(strings.NewReader(line))
+		if !r.Scan() {
+			t.Errorf("%s: log reader: want hist, got error: %v", test.name, r.Err())
+			continue
+		}
+		if err := sameHistsNoTime(h, r.Hist()); err != nil {
+			t.Errorf("%s: log reader: %v", test.name, err)
+		}
+	}
+}
+
+func TestDecodeUncompressedDouble(t *testing.T) {
+	d := NewDouble(1e6, 2)
+	for i := 1; i <= 100; i++ {
+		d.Record(float64(i) / 8)
+	}
+	var buf bytes.Buffer
+	if err := d.Encode(&buf, false); err != nil {
+		t.Fatalf("unable to encode: %v", err)
+	}
+	if cookie := binary.BigEndian.Uint32(buf.Bytes()); cookie != doubleHistCookie {
+		t.Errorf("cookie: want %#x got %#x", doubleHistCookie, cookie)
+	}
+	var got DoubleHist
+	if err := got.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatalf("unable to decode: %v", err)
+	}
+	for _, p := range []float64{0, 50, 100} {
+		if g, w := got.PercentileVal(p), d.PercentileVal(p); g != w {
+			t.Errorf("P%v: want %+v got %+v", p, w, g)
+		}
+	}
+}
+
+// encodeV0 encodes h in the legacy V0 format with 8 byte words.
+// If compressed is set, the compressed V0 format is used.
+func encodeV0(h *Hist, compressed bool) []byte {
+	var buf bytes.Buffer
+	cfg := h.Config()
+	binary.Write(&buf, binary.BigEndian, int32(encodingV0CookieBase|8<<4))
+	binary.Write(&buf, binary.BigEndian, cfg.SigFigs)
+	binary.Write(&buf, binary.BigEndian, cfg.LowestDiscernible)
+	binary.Write(&buf, binary.BigEndian, cfg.HighestTrackable)
+	binary.Write(&buf, binary.BigEndian, h.TotalCount())
+	for _, c := range h.b.counts {
+		binary.Write(&buf, binary.BigEndian, c)
+	}
+	if !compressed {
+		return buf.Bytes()
+	}
+
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	buf.WriteTo(zw)
+	zw.Close()
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, int32(compressedEncodingV0CookieBase|8<<4))
+	binary.Write(&out, binary.BigEndian, int32(zbuf.Len()))
+	zbuf.WriteTo(&out)
+	return out.Bytes()
+}
+
+func TestDecodeV0(t *testing.T) {
+	h := WithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e5,
+		SigFigs:           2,
+	})
+	h.RecordN(7, 2)
+	h.Record(500)
+	h.RecordN(9e4, 4)
+
+	// uncompressed V0 histograms can be read back to back from a stream
+	raw := encodeV0(h, false)
+	stream := bytes.NewReader(append(append([]byte{}, raw...), raw...))
+	for i := 0; i < 2; i++ {
+		got, err := Decode(stream)
+		if err != nil {
+			t.Fatalf("uncompressed %d: unable to decode: %v", i, err)
+		}
+		if err := sameHistsNoTime(h, got); err != nil {
+			t.Errorf("uncompressed %d: %v", i, err)
+		}
+	}
+
+	compressed := encodeV0(h, true)
+	var got Hist
+	if err := got.UnmarshalBinary(compressed); err != nil {
+		t.Fatalf("compressed: unable to decode: %v", err)
+	}
+	if err := sameHistsNoTime(h, &got); err != nil {
+		t.Errorf("compressed: %v", err)
+	}
+
+	log := "#[Histogram log format version 1.01]\n" +
+		"0.127,1.007,2.769," + base64.StdEncoding.EncodeToString(compressed) + "\n"
+	r := NewLogReader(strings.NewReader(log))
+	if !r.Scan() {
+		t.Fatalf("log reader: want hist, got error: %v", r.Err())
+	}
+	if err := sameHistsNoTime(h, r.Hist()); err != nil {
+		t.Errorf("log reader: %v", err)
+	}
+}
+
+// v0Fixture is a V0 histogram laid out as by
+// AbstractHistogram.encodeIntoByteBuffer in HdrHistogram 1.x
+// for a Histogram(1, 100, 1) holding 3 twice, 40 once, and 100 five times.
+//
+// With 1 significant digit, there are 32 sub buckets and
+// (bucketCount+1) * subBucketHalfCount = (3+1) * 16 = 64 counts,
+// each written as a long. 3 is at index 3, 40 at
+// (1+1)<<4 + (40>>1 - 16) = 36, and 100 at (2+1)<<4 + (100>>2 - 16) = 57.
+func v0Fixture() []byte {
+	b := []byte{
+		0x1c, 0x84, 0x93, 0x88, // cookie: 0x1c849308 | word size 8<<4
+		0, 0, 0, 1, // numberOfSignificantValueDigits
+		0, 0, 0, 0, 0, 0, 0, 1, // lowestTrackableValue
+		0, 0, 0, 0, 0, 0, 0, 100, // highestTrackableValue
+		0, 0, 0, 0, 0, 0, 0, 8, // totalCount
+	}
+	counts := make([]byte, 64*8)
+	counts[3*8+7] = 2
+	counts[36*8+7] = 1
+	counts[57*8+7] = 5
+	return append(b, counts...)
+}
+
+func TestDecodeV0Fixture(t *testing.T) {
+	fixture := v0Fixture()
+	stream := bytes.NewReader(append(append([]byte{}, fixture...), fixture...))
+	for i := 0; i < 2; i++ {
+		h, err := Decode(stream)
+		if err != nil {
+			t.Fatalf("hist %d: unable to decode: %v", i, err)
+		}
+		cfg := h.Config()
+		if cfg.LowestDiscernible != 1 || cfg.HighestTrackable != 100 || cfg.SigFigs != 1 {
+			t.Errorf("hist %d: got config %+v", i, cfg)
+		}
+		if got := h.TotalCount(); got != 8 {
+			t.Errorf("hist %d: got total count %d, want 8", i, got)
+		}
+		for _, c := range []struct{ v, count int64 }{{3, 2}, {40, 1}, {41, 1}, {100, 5}, {103, 5}, {99, 0}} {
+			if got := h.Val(c.v).Count; got != c.count {
+				t.Errorf("hist %d: got count %d at %d, want %d", i, got, c.v, c.count)
+			}
+		}
+	}
+	if stream.Len() != 0 {
+		t.Errorf("want all input consumed, %d bytes left", stream.Len())
+	}
+}
+
+func TestDecodeHeaderMetadata(t *testing.T) {
+	h := WithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1e4,
+		SigFigs:           2,
+	})
+	h.RecordN(3, 2)
+	h.Record(5000)
+
+	var buf bytes.Buffer
+	if err := h.Encode(&buf, false); err != nil {
+		t.Fatalf("unable to encode: %v", err)
+	}
+	orig := buf.Bytes()
+	const (
+		offsetPos = 8
+		ratioPos  = 32
+	)
+	withHeader := func(off int32, ratio float64) []byte {
+		b := append([]byte{}, orig...)
+		binary.BigEndian.PutUint32(b[offsetPos:], uint32(off))
+		binary.BigEndian.PutUint64(b[ratioPos:], math.Float64bits(ratio))
+		return b
+	}
+
+	data := withHeader(-17, 0.25)
+	var got Hist
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unable to decode: %v", err)
+	}
+	if err := sameHistsNoTime(h, &got); err != nil {
+		t.Errorf("normalizing offset changed values: %v", err)
+	}
+	if r := got.ConversionRatio(); r != 0.25 {
+		t.Errorf("ConversionRatio(): want 0.25 got %v", r)
+	}
+	var reencoded bytes.Buffer
+	if err := got.Encode(&reencoded, false); err != nil {
+		t.Fatalf("unable to re-encode: %v", err)
+	}
+	if !bytes.Equal(reencoded.Bytes(), data) {
+		t.Error("re-encoded hist does not preserve header metadata")
+	}
+
+	invalid := []struct {
+		off   int32
+		ratio float64
+	}{
+		{int32(len(h.b.counts)), 1},
+		{-int32(len(h.b.counts)), 1},
+		{0, 0},
+		{0, -1},
+		{0, math.NaN()},
+		{0, math.Inf(1)},
+	}
+	for _, test := range invalid {
+		var got Hist
+		if err := got.UnmarshalBinary(withHeader(test.off, test.ratio)); err == nil {
+			t.Errorf("offset %d, ratio %v: want error", test.off, test.ratio)
+		}
+	}
+}
+
+func TestZigZagRoundTrip(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 63, -64, 1 << 20, 1 << 55, -1 << 55, math.MaxInt64, math.MinInt64} {
+		b := encodeZigZag(v)
+		got, n, err := decodeZigZag(b)
+		if err != nil {
+			t.Errorf("%d: unable to decode: %v", v, err)
+			continue
+		}
+		if got != v || n != len(b) {
+			t.Errorf("%d: got %d (%d bytes), want %d bytes", v, got, n, len(b))
+		}
+	}
+}
+
+// encodeRawV2 encodes an uncompressed V2 histogram with the given header
+// fields and counts, which are written as is.
+func encodeRawV2(sigfigs int32, lowest, highest int64, counts ...int64) []byte {
+	var payload bytes.Buffer
+	for _, c := range counts {
+		payload.Write(encodeZigZag(c))
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int32(encodingV2CookieBase|0x10))
+	binary.Write(&buf, binary.BigEndian, int32(payload.Len()))
+	binary.Write(&buf, binary.BigEndian, int32(0))
+	binary.Write(&buf, binary.BigEndian, sigfigs)
+	binary.Write(&buf, binary.BigEndian, lowest)
+	binary.Write(&buf, binary.BigEndian, highest)
+	binary.Write(&buf, binary.BigEndian, float64(1))
+	payload.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	countsLen := len(WithConfig(Config{LowestDiscernible: 1, HighestTrackable: 1000, SigFigs: 1}).b.counts)
+	tooMany := make([]int64, countsLen+1)
+	for i := range tooMany {
+		tooMany[i] = 1
+	}
+	negative := encodeV1(New(1), 8)
+	negative = append(negative, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	binary.BigEndian.PutUint32(negative[4:], uint32(len(negative)-encodingHeaderSize))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"zero run past counts", encodeRawV2(1, 1, 1000, -math.MaxInt32, 1)},
+		{"too many counts", encodeRawV2(1, 1, 1000, tooMany...)},
+		{"total count overflow", encodeRawV2(1, 1, 1000, math.MaxInt64, math.MaxInt64)},
+		{"negative count", negative},
+		{"invalid sigfigs", encodeRawV2(9, 1, 1000)},
+		{"lowest too large", encodeRawV2(5, 1<<62, math.MaxInt64)},
+		{"lowest overflows", encodeRawV2(0, math.MaxInt64/2+1, math.MaxInt64)},
+		{"truncated payload", encodeRawV2(1, 1, 1000, 5, 6)[:encodingHeaderSize+1]},
+	}
+	for _, test := range tests {
+		var h Hist
+		var err error
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					t.Fatalf("%s: panic: %v", test.name, e)
+				}
+			}()
+			err = h.UnmarshalBinary(test.data)
+		}()
+		if _, ok := errors.Cause(err).(*DecodeError); !ok {
+			t.Errorf("%s: want *DecodeError, got %v", test.name, err)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	h := marshalTestHist()
+	compressed, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unable to marshal: %v", err)
+	}
+	uncompressed := encodeV1(h, 8)
+
+	tests := []struct {
+		opts  DecodeOptions
+		limit string
+	}{
+		{DecodeOptions{}, ""},
+		{DecodeOptions{
+			MaxCountsLen:         len(h.b.counts),
+			MaxDecompressedBytes: len(uncompressed),
+			MaxTotalCount:        h.TotalCount(),
+		}, ""},
+		{DecodeOptions{MaxCountsLen: len(h.b.counts) - 1}, "MaxCountsLen"},
+		{DecodeOptions{MaxDecompressedBytes: 100}, "MaxDecompressedBytes"},
+		{DecodeOptions{MaxTotalCount: h.TotalCount() - 1}, "MaxTotalCount"},
+	}
+	for _, test := range tests {
+		for _, data := range [][]byte{compressed, uncompressed} {
+			got, err := test.opts.Decode(bytes.NewReader(data))
+			if test.limit == "" {
+				if err != nil {
+					t.Errorf("%+v: unable to decode: %v", test.opts, err)
+				} else if got.TotalCount() != h.TotalCount() {
+					t.Errorf("%+v: total count: want %d got %d", test.opts, h.TotalCount(), got.TotalCount())
+				}
+				continue
+			}
+			lerr, ok := errors.Cause(err).(*LimitError)
+			if !ok {
+				t.Errorf("%+v: want *LimitError, got %v", test.opts, err)
+				continue
+			}
+			if lerr.Limit != test.limit {
+				t.Errorf("%+v: want %s exceeded, got %v", test.opts, test.limit, lerr)
+			}
+		}
+	}
+}
+
+func TestLogReaderDecodeOptions(t *testing.T) {
+	h := marshalTestHist()
+	var buf bytes.Buffer
+	if err := NewLogWriter(&buf).WriteIntervalHist(h); err != nil {
+		t.Fatalf("unable to write log: %v", err)
+	}
+	r := NewLogReader(&buf)
+	r.SetDecodeOptions(DecodeOptions{MaxTotalCount: 1})
+	if r.Scan() {
+		t.Fatal("want Scan to fail")
+	}
+	pe, ok := r.Err().(*LogParseError)
+	if !ok {
+		t.Fatalf("want *LogParseError, got %v", r.Err())
+	}
+	if _, ok := errors.Cause(pe.Err).(*LimitError); !ok {
+		t.Errorf("want *LimitError, got %v", pe.Err)
+	}
+}
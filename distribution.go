@@ -0,0 +1,183 @@
+package hdrhist
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// WritePercentileDistribution writes a table of the values of h at
+// percentiles stepped by PercentileIter(ticksPerHalfDistance),
+// followed by the mean, standard deviation, and other summary statistics.
+// Values are divided by valueUnitScaling
+// (e.g. 1e3 to write microsecond values as milliseconds).
+//
+// The output matches outputPercentileDistribution of the Java package
+// and can be plotted with the same tools.
+func (h *Hist) WritePercentileDistribution(w io.Writer, ticksPerHalfDistance int, valueUnitScaling float64) error {
+	return h.writeDistribution(w, ticksPerHalfDistance, valueUnitScaling, false)
+}
+
+// WritePercentileDistributionCSV is like WritePercentileDistribution
+// but writes the table as CSV, without the summary statistics.
+func (h *Hist) WritePercentileDistributionCSV(w io.Writer, ticksPerHalfDistance int, valueUnitScaling float64) error {
+	return h.writeDistribution(w, ticksPerHalfDistance, valueUnitScaling, true)
+}
+
+func (h *Hist) writeDistribution(w io.Writer, ticks int, scaling float64, csv bool) error {
+	if !(scaling > 0) {
+		panic("invalid valueUnitScaling: must be > 0")
+	}
+	digits := int(h.cfg.SigFigs)
+	var buf bytes.Buffer
+	if csv {
+		buf.WriteString("\"Value\",\"Percentile\",\"TotalCount\",\"1/(1-Percentile)\"\n")
+	} else {
+		buf.WriteString("       Value     Percentile TotalCount 1/(1-Percentile)\n\n")
+	}
+
+	var b []byte
+	sep := byte(' ')
+	if csv {
+		sep = ','
+	}
+	it := h.PercentileIter(ticks)
+	for it.Next() {
+		v := it.Val()
+		p := v.PercentileLevel / 100
+		b = b[:0]
+		if csv {
+			b = appendJavaFloat(b, float64(v.Value)/scaling, digits, 0)
+		} else {
+			b = appendJavaFloat(b, float64(v.Value)/scaling, digits, 12)
+		}
+		b = append(b, sep)
+		b = appendJavaFloat(b, p, 12, 0)
+		b = append(b, sep)
+		if csv {
+			b = strconv.AppendInt(b, v.CumCount, 10)
+		} else {
+			b = appendPadded(b, strconv.AppendInt(nil, v.CumCount, 10), 10)
+		}
+		switch {
+		case v.PercentileLevel != 100:
+			b = append(b, sep)
+			if csv {
+				b = appendJavaFloat(b, 1/(1-p), 2, 0)
+			} else {
+				b = appendJavaFloat(b, 1/(1-p), 2, 14)
+			}
+		case csv:
+			b = append(b, ",Infinity"...)
+		}
+		b = append(b, '\n')
+		buf.Write(b)
+	}
+
+	if !csv {
+		b = append(b[:0], "#[Mean    = "...)
+		b = appendJavaFloat(b, h.Mean()/scaling, digits, 12)
+		b = append(b, ", StdDeviation   = "...)
+		b = appendJavaFloat(b, h.Stdev()/scaling, digits, 12)
+		b = append(b, "]\n#[Max     = "...)
+		b = appendJavaFloat(b, float64(h.Max())/scaling, digits, 12)
+		b = append(b, ", Total count    = "...)
+		b = appendPadded(b, strconv.AppendInt(nil, h.totalCount, 10), 12)
+		b = append(b, "]\n#[Buckets = "...)
+		b = appendPadded(b, strconv.AppendInt(nil, int64(h.b.bucketCount), 10), 12)
+		b = append(b, ", SubBuckets     = "...)
+		b = appendPadded(b, strconv.AppendInt(nil, int64(h.b.subCount), 10), 12)
+		b = append(b, "]\n"...)
+		buf.Write(b)
+	}
+	_, err := buf.WriteTo(w)
+	return errors.Wrap(err, "unable to write percentile distribution")
+}
+
+// appendPadded appends s to b, right-aligned to width.
+func appendPadded(b, s []byte, width int) []byte {
+	for i := len(s); i < width; i++ {
+		b = append(b, ' ')
+	}
+	return append(b, s...)
+}
+
+// appendJavaFloat appends v with prec digits after the decimal point,
+// right-aligned to width, as by %<width>.<prec>f in Java.
+// Unlike Go, Java rounds half up from the shortest decimal
+// representation of v, so 0.125 is written as 0.13 with 2 digits.
+func appendJavaFloat(b []byte, v float64, prec, width int) []byte {
+	switch {
+	case math.IsNaN(v):
+		return appendPadded(b, []byte("NaN"), width)
+	case math.IsInf(v, 1):
+		return appendPadded(b, []byte("Infinity"), width)
+	case math.IsInf(v, -1):
+		return appendPadded(b, []byte("-Infinity"), width)
+	}
+
+	var out []byte
+	if math.Signbit(v) {
+		out = append(out, '-')
+		v = -v
+	}
+
+	// Split the shortest representation into digits and
+	// the number of digits before the decimal point.
+	var sbuf [32]byte
+	s := strconv.AppendFloat(sbuf[:0], v, 'e', -1, 64)
+	e := bytes.IndexByte(s, 'e')
+	exp, _ := strconv.Atoi(string(s[e+1:]))
+	digits := make([]byte, 0, e)
+	for _, c := range s[:e] {
+		if c != '.' {
+			digits = append(digits, c)
+		}
+	}
+	point := exp + 1
+
+	// Round half up to point+prec digits.
+	if n := point + prec; n < len(digits) {
+		if n < 0 {
+			digits = digits[:0]
+		} else {
+			up := digits[n] >= '5'
+			digits = digits[:n]
+			for i := n - 1; up && i >= 0; i-- {
+				if digits[i] == '9' {
+					digits[i] = '0'
+				} else {
+					digits[i]++
+					up = false
+				}
+			}
+			if up {
+				digits = append([]byte{'1'}, digits...)
+				point++
+			}
+		}
+	}
+
+	digit := func(i int) byte {
+		if i < 0 || i >= len(digits) {
+			return '0'
+		}
+		return digits[i]
+	}
+	if point <= 0 {
+		out = append(out, '0')
+	}
+	for i := 0; i < point; i++ {
+		out = append(out, digit(i))
+	}
+	if prec > 0 {
+		out = append(out, '.')
+		for i := point; i < point+prec; i++ {
+			out = append(out, digit(i))
+		}
+	}
+	return appendPadded(b, out, width)
+}
@@ -0,0 +1,91 @@
+package hdrhist
+
+import (
+	"bytes"
+	"testing"
+)
+
+func distributionTestHist() *Hist {
+	h := WithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  3600 * 1000 * 1000,
+		SigFigs:           3,
+	})
+	for v := int64(1); v <= 100; v++ {
+		h.Record(v * 1000)
+	}
+	return h
+}
+
+func TestWritePercentileDistribution(t *testing.T) {
+	const want = `       Value     Percentile TotalCount 1/(1-Percentile)
+
+       1.000 0.000000000000          1           1.00
+      50.015 0.500000000000         50           2.00
+      75.007 0.750000000000         75           4.00
+      88.063 0.875000000000         88           8.00
+      94.015 0.937500000000         94          16.00
+      97.023 0.968750000000         97          32.00
+      99.007 0.984375000000         99          64.00
+     100.031 0.992187500000        100         128.00
+     100.031 1.000000000000        100
+#[Mean    =       50.504, StdDeviation   =       28.866]
+#[Max     =      100.031, Total count    =          100]
+#[Buckets =           22, SubBuckets     =         2048]
+`
+	var buf bytes.Buffer
+	if err := distributionTestHist().WritePercentileDistribution(&buf, 1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWritePercentileDistributionCSV(t *testing.T) {
+	const want = `"Value","Percentile","TotalCount","1/(1-Percentile)"
+1.000,0.000000000000,1,1.00
+50.015,0.500000000000,50,2.00
+75.007,0.750000000000,75,4.00
+88.063,0.875000000000,88,8.00
+94.015,0.937500000000,94,16.00
+97.023,0.968750000000,97,32.00
+99.007,0.984375000000,99,64.00
+100.031,0.992187500000,100,128.00
+100.031,1.000000000000,100,Infinity
+`
+	var buf bytes.Buffer
+	if err := distributionTestHist().WritePercentileDistributionCSV(&buf, 1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestAppendJavaFloat(t *testing.T) {
+	tests := []struct {
+		v     float64
+		prec  int
+		width int
+		want  string
+	}{
+		{0, 3, 0, "0.000"},
+		{0.125, 2, 0, "0.13"},
+		{1.005, 2, 0, "1.01"},
+		{2.5, 0, 0, "3"},
+		{0.0004, 3, 0, "0.000"},
+		{0.0005, 3, 0, "0.001"},
+		{999.9996, 3, 0, "1000.000"},
+		{-1.5, 0, 4, "  -2"},
+		{123456789, 3, 12, "123456789.000"},
+		{1e-20, 2, 6, "  0.00"},
+		{1.1e21, 1, 0, "1100000000000000000000.0"},
+	}
+	for _, test := range tests {
+		got := string(appendJavaFloat(nil, test.v, test.prec, test.width))
+		if got != test.want {
+			t.Errorf("appendJavaFloat(%v, %d, %d) = %q, want %q", test.v, test.prec, test.width, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package hdrhist
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DoubleHist maintains a distribution of floating-point values
+// with a predetermined level of precision.
+//
+// A DoubleHist covers a dynamic range of values:
+// the ratio between the largest and smallest non-zero values
+// that may be recorded is fixed when the DoubleHist is created,
+// but the range itself shifts by powers of two as values are recorded.
+// Internally, values are recorded in an integer Hist and are converted
+// using an integer to double conversion ratio.
+//
+// DoubleHist is a port of DoubleHistogram from the Java HdrHistogram package
+// and is able to encode and decode histograms produced by it.
+type DoubleHist struct {
+	ratio int64 // configured highest to lowest value ratio
+	h     Hist
+
+	lowestTracking  int64 // lowest integer value with full precision
+	curLowest       float64
+	curHighestLimit float64
+	intToF64        float64
+	f64ToInt        float64
+}
+
+// DoubleHistVal is the floating-point analogue of HistVal.
+type DoubleHistVal struct {
+	Value      float64
+	Count      int64
+	CumCount   int64
+	Percentile float64
+}
+
+// NewDouble creates a new DoubleHist where the largest recorded value
+// may be up to ratio times the smallest non-zero recorded value.
+// ratio must be at least 2.
+// Valid values for sigfigs are between 0 and 5.
+func NewDouble(ratio int64, sigfigs int32) *DoubleHist {
+	var d DoubleHist
+	d.Init(ratio, sigfigs)
+	return &d
+}
+
+func checkDoubleConfig(ratio int64, sigfigs int32) error {
+	if ratio < 2 {
+		return errors.New("invalid cfg: ratio must be >= 2")
+	}
+	if sigfigs < 0 || sigfigs > 5 {
+		return errors.New("invalid cfg: must have SigFigs ∈ [0,5]")
+	}
+	if float64(ratio)*math.Pow10(int(sigfigs)) >= 1<<61 {
+		return errors.New("invalid cfg: ratio * 10^SigFigs must be < 2^61")
+	}
+	return nil
+}
+
+// Init initializes the DoubleHist with the given
+// highest to lowest value ratio and significant figures.
+func (d *DoubleHist) Init(ratio int64, sigfigs int32) {
+	if err := checkDoubleConfig(ratio, sigfigs); err != nil {
+		panic(err.Error())
+	}
+	d.ratio = ratio
+	cfg, lowestTracking, internalRatio := doubleIntConfig(ratio, sigfigs)
+	d.lowestTracking = lowestTracking
+	d.h.Init(cfg)
+	d.setRange(1, float64(internalRatio))
+}
+
+// doubleIntConfig returns the Config of the integer Hist
+// backing a DoubleHist along with its lowest tracking value
+// and internal ratio.
+func doubleIntConfig(ratio int64, sigfigs int32) (cfg Config, lowestTracking, internalRatio int64) {
+	// The internal dynamic range needs to be one order of magnitude larger
+	// than the containing binary order of magnitude of the ratio.
+	internalRatio = int64(1) << uint(64-clz64(uint64(ratio))+1)
+
+	cfg = Config{LowestDiscernible: 1, HighestTrackable: 2, SigFigs: sigfigs}
+	lowestTracking = int64(cfg.layout().subHalfCount)
+	cfg.HighestTrackable = lowestTracking*internalRatio - 1
+	return cfg, lowestTracking, internalRatio
+}
+
+// initFromInt initializes the DoubleHist from a decoded integer Hist.
+func (d *DoubleHist) initFromInt(ratio int64, h *Hist) error {
+	if err := checkDoubleConfig(ratio, h.cfg.SigFigs); err != nil {
+		return err
+	}
+	intToF64 := h.ConversionRatio()
+	d.Init(ratio, h.cfg.SigFigs)
+	if max := h.Max(); max > d.h.cfg.HighestTrackable {
+		return errors.Errorf("integer values up to %d exceed the range of the double hist", max)
+	}
+	d.h.Add(h)
+	d.h.startTime = h.startTime
+	d.h.endTime = h.endTime
+	lowest := intToF64 * float64(d.lowestTracking)
+	d.setRange(lowest, lowest*float64(d.internalRatio()))
+	return nil
+}
+
+func (d *DoubleHist) internalRatio() int64 {
+	return (d.h.cfg.HighestTrackable + 1) / d.lowestTracking
+}
+
+func (d *DoubleHist) setRange(lowest, highestLimit float64) {
+	d.curLowest = lowest
+	d.curHighestLimit = highestLimit
+	d.intToF64 = lowest / float64(d.lowestTracking)
+	d.f64ToInt = 1 / d.intToF64
+	d.h.f64Ratio = d.intToF64
+}
+
+// Clone returns a deep copy of the histogram.
+func (d *DoubleHist) Clone() *DoubleHist {
+	d2 := *d
+	d2.h = *d.h.Clone()
+	return &d2
+}
+
+func (d *DoubleHist) Record(v float64) { d.RecordN(v, 1) }
+
+func (d *DoubleHist) RecordN(v float64, count int64) {
+	if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		panic("value must be finite and non-negative")
+	}
+	if v != 0 && (v < d.curLowest || v >= d.curHighestLimit) {
+		d.adjustRange(v)
+	}
+	d.h.RecordN(int64(v*d.f64ToInt), count)
+}
+
+func (d *DoubleHist) RecordCorrected(v float64, expectedInterval float64) {
+	d.RecordN(v, 1)
+	if expectedInterval <= 0 {
+		return
+	}
+	missing := v - expectedInterval
+	for missing >= expectedInterval {
+		d.RecordN(missing, 1)
+		missing -= expectedInterval
+	}
+}
+
+// adjustRange shifts the covered range so that v can be recorded.
+func (d *DoubleHist) adjustRange(v float64) {
+	if v < d.curLowest {
+		for v < d.curLowest {
+			k := d.cappedBinaryOrder(math.Ceil(d.curLowest/v) - 1)
+			// the range moves down, so integer values must move up
+			if err := d.h.shiftLeft(k); err != nil {
+				panic(d.rangeErr(v))
+			}
+			scale := math.Ldexp(1, -int(k))
+			d.setRange(d.curLowest*scale, d.curHighestLimit*scale)
+		}
+		return
+	}
+	for v >= d.curHighestLimit {
+		ulp := math.Nextafter(v, math.Inf(1)) - v
+		k := d.cappedBinaryOrder(math.Ceil((v+ulp)/d.curHighestLimit) - 1)
+		// the range moves up, so integer values must move down
+		if err := d.h.shiftRight(k); err != nil {
+			panic(d.rangeErr(v))
+		}
+		scale := math.Ldexp(1, int(k))
+		d.setRange(d.curLowest*scale, d.curHighestLimit*scale)
+	}
+}
+
+func (d *DoubleHist) rangeErr(v float64) string {
+	return errors.Errorf(
+		"value %v is out of range, covered range [%v, %v) cannot be extended any further",
+		v, d.curLowest, d.curHighestLimit).Error()
+}
+
+// cappedBinaryOrder returns the number of bits needed to hold ⌈f⌉,
+// capped so that a single shift never exceeds the configured ratio.
+func (d *DoubleHist) cappedBinaryOrder(f float64) uint {
+	if f > float64(d.ratio) {
+		return uint(math.Log2(float64(d.ratio)))
+	}
+	if f > 1<<50 {
+		return 50
+	}
+	return uint(64 - clz64(uint64(math.Ceil(f))))
+}
+
+// Add adds all values recorded in o to d.
+// Add panics if the combined values cannot be covered by d.
+func (d *DoubleHist) Add(o *DoubleHist) {
+	if d.intToF64 == o.intToF64 &&
+		d.h.b.bucketCount == o.h.b.bucketCount &&
+		d.h.b.subCount == o.h.b.subCount {
+
+		// fast path, integer values line up
+		d.h.Add(&o.h)
+	} else {
+		for i, count := range o.h.b.counts {
+			if count > 0 {
+				d.RecordN(float64(o.h.b.valueFor(i))*o.intToF64, count)
+			}
+		}
+	}
+
+	d.h.mergeTimes(&o.h)
+	if d.h.tag == "" {
+		d.h.tag = o.h.tag
+	}
+}
+
+// Ratio returns the configured highest to lowest value ratio.
+func (d *DoubleHist) Ratio() int64 { return d.ratio }
+
+// SigFigs returns the number of significant figures maintained by d.
+func (d *DoubleHist) SigFigs() int32 { return d.h.cfg.SigFigs }
+
+// Range returns the range of values that can currently be recorded
+// without shifting the covered range.
+func (d *DoubleHist) Range() (lowest, highestLimit float64) {
+	return d.curLowest, d.curHighestLimit
+}
+
+func (d *DoubleHist) TotalCount() int64 { return d.h.TotalCount() }
+
+func (d *DoubleHist) Max() float64 { return float64(d.h.Max()) * d.intToF64 }
+func (d *DoubleHist) Min() float64 { return float64(d.h.Min()) * d.intToF64 }
+
+func (d *DoubleHist) Mean() float64  { return d.h.Mean() * d.intToF64 }
+func (d *DoubleHist) Stdev() float64 { return d.h.Stdev() * d.intToF64 }
+
+// PercentileVal returns the DoubleHistVal at the requested percentile p.
+// p should be in the range [0, 100].
+func (d *DoubleHist) PercentileVal(p float64) DoubleHistVal {
+	return d.toF64(d.h.PercentileVal(p))
+}
+
+func (d *DoubleHist) toF64(hv HistVal) DoubleHistVal {
+	return DoubleHistVal{
+		Value:      float64(hv.Value) * d.intToF64,
+		Count:      hv.Count,
+		CumCount:   hv.CumCount,
+		Percentile: hv.Percentile,
+	}
+}
+
+func (d *DoubleHist) Tag() string                  { return d.h.Tag() }
+func (d *DoubleHist) StartTime() (time.Time, bool) { return d.h.StartTime() }
+func (d *DoubleHist) EndTime() (time.Time, bool)   { return d.h.EndTime() }
+func (d *DoubleHist) SetTag(tag string)            { d.h.SetTag(tag) }
+func (d *DoubleHist) SetStartTime(t time.Time)     { d.h.SetStartTime(t) }
+func (d *DoubleHist) SetEndTime(t time.Time)       { d.h.SetEndTime(t) }
+
+// Clear deletes all recorded values as well as the start and end times and the tag.
+// The covered range is left unchanged.
+func (d *DoubleHist) Clear() { d.h.Clear() }
@@ -0,0 +1,192 @@
+package hdrhist
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func withinSigFigs(got, want float64, sigfigs int32) bool {
+	return math.Abs(got-want) <= want*math.Pow10(-int(sigfigs))
+}
+
+func TestDoubleHistRecordShifts(t *testing.T) {
+	d := NewDouble(1e7, 3)
+	vals := []float64{1000, 0.001, 2.5, 0.125, 333.3, 0}
+	for _, v := range vals {
+		d.Record(v)
+	}
+	if c := d.TotalCount(); c != int64(len(vals)) {
+		t.Fatalf("total count: want %d got %d", len(vals), c)
+	}
+	if min := d.Min(); min != 0 {
+		t.Errorf("Min(): want 0 got %v", min)
+	}
+	if max := d.Max(); !withinSigFigs(max, 1000, 3) {
+		t.Errorf("Max(): want ~1000 got %v", max)
+	}
+	lowest, highest := d.Range()
+	if lowest > 0.001 || highest <= 1000 {
+		t.Errorf("Range(): want to cover [0.001, 1000], got [%v, %v)", lowest, highest)
+	}
+
+	tests := []struct {
+		p float64
+		v float64
+	}{
+		{34, 0.001},
+		{50, 0.125},
+		{67, 2.5},
+		{84, 333.3},
+	}
+	for _, test := range tests {
+		if v := d.PercentileVal(test.p).Value; !withinSigFigs(v, test.v, 3) {
+			t.Errorf("PercentileVal(%v): want ~%v got %v", test.p, test.v, v)
+		}
+	}
+}
+
+func TestDoubleHistOutOfRange(t *testing.T) {
+	d := NewDouble(1000, 2)
+	d.Record(1)
+	if !doesPanic(func() { d.Record(1e9) }) {
+		t.Error("want panic when exceeding ratio above")
+	}
+	if !doesPanic(func() { d.Record(1e-9) }) {
+		t.Error("want panic when exceeding ratio below")
+	}
+	if !doesPanic(func() { d.Record(-1) }) {
+		t.Error("want panic when recording negative value")
+	}
+	if c := d.TotalCount(); c != 1 {
+		t.Errorf("total count: want 1 got %d", c)
+	}
+}
+
+func TestDoubleHistAdd(t *testing.T) {
+	d1 := NewDouble(1e6, 3)
+	d2 := NewDouble(1e6, 3)
+	for i := 1; i <= 100; i++ {
+		d1.Record(float64(i) / 1000)
+		d2.Record(float64(i))
+	}
+	d1.Add(d2)
+	if c := d1.TotalCount(); c != 200 {
+		t.Fatalf("total count: want 200 got %d", c)
+	}
+	if v := d1.PercentileVal(25).Value; !withinSigFigs(v, 0.05, 3) {
+		t.Errorf("P25: want ~0.05 got %v", v)
+	}
+	if v := d1.PercentileVal(75).Value; !withinSigFigs(v, 50, 3) {
+		t.Errorf("P75: want ~50 got %v", v)
+	}
+	if mean, want := d1.Mean(), (50.5+0.0505)/2; !withinSigFigs(mean, want, 2) {
+		t.Errorf("Mean(): want ~%v got %v", want, mean)
+	}
+}
+
+func TestDoubleHistLogRoundTrip(t *testing.T) {
+	d := NewDouble(1e9, 3)
+	for i := 0; i < 1000; i++ {
+		d.Record(float64(i) * 1e-6)
+	}
+	start := time.Unix(100, 0)
+	d.SetStartTime(start)
+	d.SetEndTime(start.Add(time.Second))
+
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	if err := w.WriteIntervalDoubleHist(d); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+
+	r := NewLogReader(&buf)
+	r.SetDoubleHists(true)
+	if !r.Scan() {
+		t.Fatalf("want hist, got error: %v", r.Err())
+	}
+	if h := r.Hist(); h != nil {
+		t.Errorf("Hist(): want nil for double hist, got %v", h)
+	}
+	got := r.DoubleHist()
+	if got == nil {
+		t.Fatal("DoubleHist(): want hist")
+	}
+	if got.TotalCount() != d.TotalCount() {
+		t.Errorf("total count: want %d got %d", d.TotalCount(), got.TotalCount())
+	}
+	if got.Ratio() != d.Ratio() || got.SigFigs() != d.SigFigs() {
+		t.Errorf("config: want (%d, %d) got (%d, %d)", d.Ratio(), d.SigFigs(), got.Ratio(), got.SigFigs())
+	}
+	for _, p := range []float64{0, 10, 50, 90, 99.9, 100} {
+		if g, w := got.PercentileVal(p), d.PercentileVal(p); g != w {
+			t.Errorf("P%v: want %+v got %+v", p, w, g)
+		}
+	}
+	if st, ok := got.StartTime(); !ok || !st.Equal(start) {
+		t.Errorf("start time: want %v got %v", start, st)
+	}
+}
+
+func TestLogReaderDoubleHists(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	h := New(3)
+	h.Record(42)
+	d := NewDouble(1e9, 3)
+	d.Record(0.5)
+	start := time.Unix(100, 0)
+	for i, write := range []func() error{
+		func() error { return w.WriteIntervalHist(h) },
+		func() error { return w.WriteIntervalDoubleHist(d) },
+		func() error { return w.WriteIntervalHist(h) },
+	} {
+		h.SetStartTime(start.Add(time.Duration(i) * time.Second))
+		d.SetStartTime(start.Add(time.Duration(i) * time.Second))
+		if err := write(); err != nil {
+			t.Fatalf("unable to write hist %d: %v", i, err)
+		}
+	}
+	data := buf.Bytes()
+
+	count := func(name string, scan func() bool, hist func() *Hist, err func() error) {
+		n := 0
+		for scan() {
+			if hist() == nil {
+				t.Errorf("%s: hist %d: Hist() is nil", name, n)
+			}
+			n++
+		}
+		if err() != nil {
+			t.Errorf("%s: %v", name, err())
+		}
+		if n != 2 {
+			t.Errorf("%s: got %d hists, want 2", name, n)
+		}
+	}
+
+	// Double histograms are skipped by default and by ScanInto.
+	r := NewLogReader(bytes.NewReader(data))
+	count("Scan", r.Scan, r.Hist, r.Err)
+	r = NewLogReader(bytes.NewReader(data))
+	r.SetDoubleHists(true)
+	var into Hist
+	count("ScanInto", func() bool { return r.ScanInto(&into) }, r.Hist, r.Err)
+	p := NewParallelLogReader(NewLogReader(bytes.NewReader(data)), 2)
+	count("ParallelLogReader", p.Scan, p.Hist, p.Err)
+	p.Close()
+
+	r = NewLogReader(bytes.NewReader(data))
+	r.SetDoubleHists(true)
+	var got []bool
+	for r.Scan() {
+		got = append(got, r.DoubleHist() != nil && r.Hist() == nil)
+	}
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	if len(got) != 3 || got[0] || !got[1] || got[2] {
+		t.Errorf("SetDoubleHists: got double hists at %v, want [false true false]", got)
+	}
+}
@@ -34,13 +34,12 @@ func encodeInto(h *Hist, w io.Writer, max int64) error {
 	var cookie int32 = encodingCookie
 	binary.Write(&buf, binary.BigEndian, cookie)
 	buf.WriteString("\x00\x00\x00\x00") // length will go here
-	buf.WriteString("\x00\x00\x00\x00") // normalizing index offset
+	binary.Write(&buf, binary.BigEndian, h.normalizingIndexOff)
 	cfg := h.Config()
 	binary.Write(&buf, binary.BigEndian, int32(cfg.SigFigs))
 	binary.Write(&buf, binary.BigEndian, int64(cfg.LowestDiscernible))
 	binary.Write(&buf, binary.BigEndian, int64(cfg.HighestTrackable))
-	// int to double conversion ratio
-	buf.WriteString("\x3f\xf0\x00\x00\x00\x00\x00\x00")
+	binary.Write(&buf, binary.BigEndian, h.ConversionRatio())
 	payloadStart := buf.Len()
 	fillBuffer(&buf, h, importantLen)
 	binary.BigEndian.PutUint32(buf.Bytes()[4:], uint32(buf.Len()-payloadStart))
@@ -48,6 +47,28 @@ func encodeInto(h *Hist, w io.Writer, max int64) error {
 	return errors.Wrap(err, "unable to write uncompressed hist")
 }
 
+func encodeDoubleCompressed(d *DoubleHist, w io.Writer) error {
+	var buf bytes.Buffer
+	var cookie int32 = doubleHistCompressedCookie
+	binary.Write(&buf, binary.BigEndian, cookie)
+	binary.Write(&buf, binary.BigEndian, d.ratio)
+	// not writing to disk yet, won't fail
+	encodeCompressed(&d.h, &buf, d.h.Max())
+	_, err := buf.WriteTo(w)
+	return errors.Wrap(err, "unable to write compressed double hist")
+}
+
+func encodeDouble(d *DoubleHist, w io.Writer) error {
+	var buf bytes.Buffer
+	var cookie int32 = doubleHistCookie
+	binary.Write(&buf, binary.BigEndian, cookie)
+	binary.Write(&buf, binary.BigEndian, d.ratio)
+	// not writing to disk yet, won't fail
+	encodeInto(&d.h, &buf, d.h.Max())
+	_, err := buf.WriteTo(w)
+	return errors.Wrap(err, "unable to write uncompressed double hist")
+}
+
 func fillBuffer(buf *bytes.Buffer, h *Hist, n int) {
 	srci := 0
 	for srci < n {
@@ -0,0 +1,145 @@
+// +build go1.7
+
+package hdrhist
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFollowPoll is the interval at which FollowLogReader
+// checks for new data when no poll interval is given.
+const DefaultFollowPoll = 100 * time.Millisecond
+
+// FollowLogReader opens the named log file for reading
+// and follows it as it is written, like tail -f.
+//
+// At the end of the file, Scan blocks until more complete lines are
+// written or ctx is done, in which case Scan returns false and Err
+// returns an error whose cause is ctx.Err().
+// Partially written lines are not read until they are complete.
+//
+// The file is checked for new data every poll (DefaultFollowPoll if zero).
+// If the file is truncated, it is read again from the start.
+// If the file is replaced, for example by log rotation, the rest of the
+// old file is read and then the new file is read from the start.
+//
+// The caller must call Close when done with the LogReader.
+func FollowLogReader(ctx context.Context, name string, poll time.Duration) (*LogReader, error) {
+	if poll <= 0 {
+		poll = DefaultFollowPoll
+	}
+	r := &followReader{ctx: ctx, name: name, poll: poll}
+	if err := r.open(); err != nil {
+		return nil, errors.Wrap(err, "unable to open log")
+	}
+	l := NewLogReader(r)
+	l.c = []io.Closer{r}
+	return l, nil
+}
+
+// followReader reads complete lines from a file that is being written.
+type followReader struct {
+	ctx  context.Context
+	name string
+	poll time.Duration
+
+	f   *os.File
+	fi  os.FileInfo
+	off int64 // bytes read from f
+
+	chunk   []byte
+	ready   []byte // complete lines to be returned by Read
+	pending []byte // partial line following ready
+}
+
+func (r *followReader) open() error {
+	f, err := os.Open(r.name)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if r.f != nil {
+		r.f.Close()
+	}
+	r.f, r.fi, r.off = f, fi, 0
+	r.pending = r.pending[:0]
+	return nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	if r.chunk == nil {
+		r.chunk = make([]byte, 32<<10)
+	}
+	for len(r.ready) == 0 {
+		n, err := r.read()
+		if err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			continue
+		}
+		cur, err := os.Stat(r.name)
+		switch {
+		case err == nil && !os.SameFile(cur, r.fi):
+			// Replaced: finish the old file before switching.
+			if n, err := r.read(); n > 0 || err != nil {
+				continue
+			}
+			if err := r.open(); err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+			continue
+		case err == nil && cur.Size() < r.off:
+			// Truncated: read again from the start.
+			if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			r.off = 0
+			r.pending = r.pending[:0]
+			continue
+		case err != nil && !os.IsNotExist(err):
+			return 0, err
+		}
+		// No new data, or the file is being replaced.
+		t := time.NewTimer(r.poll)
+		select {
+		case <-r.ctx.Done():
+			t.Stop()
+			return 0, r.ctx.Err()
+		case <-t.C:
+		}
+	}
+	n := copy(p, r.ready)
+	r.ready = r.ready[n:]
+	return n, nil
+}
+
+// read reads from the file, moving any complete lines to r.ready.
+// It returns the number of bytes read, which is 0 at the end of the file.
+func (r *followReader) read() (int, error) {
+	n, err := r.f.Read(r.chunk)
+	r.off += int64(n)
+	r.pending = append(r.pending, r.chunk[:n]...)
+	if i := bytes.LastIndexByte(r.pending, '\n'); i >= 0 {
+		r.ready = append(r.ready[:0], r.pending[:i+1]...)
+		r.pending = append(r.pending[:0], r.pending[i+1:]...)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,114 @@
+// +build go1.7
+
+package hdrhist
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// followTestLog returns a log with a header and a histogram
+// for each of counts.
+func followTestLog(counts ...int64) []byte {
+	var buf bytes.Buffer
+	start := time.Unix(1500000000, 0)
+	lw := NewLogWriterWithConfig(&buf, LogWriterConfig{StartTime: start, BaseTime: start})
+	for _, c := range counts {
+		if err := lw.Write(rotatingTestHist(start, c)); err != nil {
+			panic(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func appendFile(t *testing.T, name string, b []byte) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowLogReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdrhist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "follow.hlog")
+
+	appendFile(t, name, followTestLog(1, 2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lr, err := FollowLogReader(ctx, name, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lr.Close()
+
+	expect := func(count int64) {
+		if !lr.Scan() {
+			t.Fatalf("Scan returned false: %v", lr.Err())
+		}
+		if got := lr.Hist().TotalCount(); got != count {
+			t.Fatalf("got count %d, want %d", got, count)
+		}
+	}
+	expect(1)
+	expect(2)
+
+	// A line written in pieces is read once complete.
+	whole := followTestLog(2, 3)
+	line := whole[bytes.LastIndexByte(whole[:len(whole)-1], '\n')+1:]
+	appendFile(t, name, line[:len(line)/2])
+	rest := line[len(line)/2:]
+	time.AfterFunc(20*time.Millisecond, func() {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.Write(rest)
+		f.Close()
+	})
+	expect(3)
+
+	// Truncated files are read from the start.
+	if err := ioutil.WriteFile(name, followTestLog(4), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(4)
+
+	// Replaced files are read from the start
+	// after the rest of the old file.
+	appendFile(t, name, followTestLog(5)[len(followTestLog()):])
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, name, followTestLog(6))
+	expect(5)
+	expect(6)
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if lr.Scan() {
+		t.Fatal("Scan returned true after cancel")
+	}
+	if errors.Cause(lr.Err()) != context.Canceled {
+		t.Errorf("got error %v, want %v", lr.Err(), context.Canceled)
+	}
+	if len(lr.ParseErrors()) != 0 {
+		t.Errorf("got parse errors: %v", lr.ParseErrors())
+	}
+}
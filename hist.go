@@ -2,7 +2,10 @@ package hdrhist
 
 import (
 	"math"
+	"sort"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Config contains the options that can be used to
@@ -40,8 +43,26 @@ type Hist struct {
 	cfg        Config
 	totalCount int64
 
-	startTime *time.Time
-	endTime   *time.Time
+	// min and max are the exact lowest and highest recorded values
+	// and sum is the exact sum of the recorded values.
+	// They are derived from the counts when the values are not known,
+	// see ExactMin.
+	min, max int64
+	sum      int128
+
+	startTime optTime
+	endTime   optTime
+	tag       string
+
+	// normalizingIndexOff is the normalizing index offset
+	// of a decoded histogram and is written back when encoding.
+	// It only describes the internal layout used by HdrHistogram
+	// and does not affect the values of h.
+	normalizingIndexOff int32
+
+	// f64Ratio is the integer to double conversion ratio.
+	// The zero value is treated as 1.
+	f64Ratio float64
 }
 
 type buckets struct {
@@ -72,6 +93,19 @@ func (h *Hist) Clone() *Hist {
 	return &h2
 }
 
+// copyFrom makes h a deep copy of o,
+// reusing the memory of h's counts if possible.
+func (h *Hist) copyFrom(o *Hist) {
+	counts := h.b.counts
+	if cap(counts) < len(o.b.counts) {
+		counts = make([]int64, len(o.b.counts))
+	}
+	counts = counts[:len(o.b.counts)]
+	copy(counts, o.b.counts)
+	*h = *o
+	h.b.counts = counts
+}
+
 type HistVal struct {
 	Value      int64
 	Count      int64
@@ -98,44 +132,83 @@ func WithConfig(cfg Config) *Hist {
 	return &h
 }
 
-// Init initializes the Hist with the given Config.
-func (h *Hist) Init(cfg Config) {
+// validate checks that cfg can be used to initialize a Hist.
+func (cfg Config) validate() error {
 	if cfg.LowestDiscernible < 1 {
-		panic("invalid cfg: LowestDiscernible must be >= 1")
+		return errors.New("invalid cfg: LowestDiscernible must be >= 1")
 	}
-	if cfg.HighestTrackable < 2*cfg.LowestDiscernible {
-		if cfg.AutoResize {
-			cfg.HighestTrackable = 2 * cfg.LowestDiscernible
-		} else {
-			panic("invalid cfg: HighestTrackable must be >= 2*LowestDiscernible")
-		}
+	// HighestTrackable/2 avoids overflowing 2*LowestDiscernible
+	if cfg.HighestTrackable/2 < cfg.LowestDiscernible && !cfg.AutoResize {
+		return errors.New("invalid cfg: HighestTrackable must be >= 2*LowestDiscernible")
 	}
 	if cfg.SigFigs < 0 || cfg.SigFigs > 5 {
-		panic("invalid cfg: must have SigFigs ∈ [0,5]")
+		return errors.New("invalid cfg: must have SigFigs ∈ [0,5]")
 	}
-	h.cfg = cfg
+	if unitMag, subHalfCountMag := cfg.magnitudes(); unitMag+subHalfCountMag > 61 {
+		return errors.New("invalid cfg: LowestDiscernible too large for SigFigs")
+	}
+	return nil
+}
 
-	unitMag := int32(math.Floor(math.Log2(float64(cfg.LowestDiscernible))))
+// magnitudes returns the unit and sub-bucket half count magnitudes for cfg.
+func (cfg Config) magnitudes() (unitMag, subHalfCountMag int32) {
+	unitMag = int32(math.Floor(math.Log2(float64(cfg.LowestDiscernible))))
 	largestSingleUnitResolutionValue := 2 * math.Pow10(int(cfg.SigFigs))
 	subCountMag := int32(math.Ceil(math.Log2(largestSingleUnitResolutionValue)))
-	subHalfCountMag := int32(0)
 	if subCountMag > 1 {
 		subHalfCountMag = subCountMag - 1
 	}
+	return unitMag, subHalfCountMag
+}
+
+// layout returns the buckets for a valid cfg without allocating counts.
+func (cfg Config) layout() buckets {
+	if cfg.HighestTrackable < 2*cfg.LowestDiscernible {
+		cfg.HighestTrackable = 2 * cfg.LowestDiscernible
+	}
+	unitMag, subHalfCountMag := cfg.magnitudes()
 	subCount := int32(math.Pow(2, float64(subHalfCountMag+1)))
-	subHalfCount := subCount / 2
-	subMask := (int64(subCount) - 1) << uint64(unitMag)
-	bucketCount := numBucketsToCoverVal(cfg.HighestTrackable, subCount, unitMag)
-	countsLen := (bucketCount + 1) * subHalfCount
-
-	h.b.counts = make([]int64, countsLen)
-	h.b.subHalfCount = subHalfCount
-	h.b.subHalfCountMag = subHalfCountMag
-	h.b.subMask = subMask
-	h.b.subCount = subCount
-	h.b.bucketCount = bucketCount
-	h.b.unitMag = unitMag
-	h.b.leadZeroCountBase = 64 - unitMag - subHalfCountMag - 1
+	return buckets{
+		subHalfCount:      subCount / 2,
+		subHalfCountMag:   subHalfCountMag,
+		subMask:           (int64(subCount) - 1) << uint64(unitMag),
+		subCount:          subCount,
+		bucketCount:       numBucketsToCoverVal(cfg.HighestTrackable, subCount, unitMag),
+		unitMag:           unitMag,
+		leadZeroCountBase: 64 - unitMag - subHalfCountMag - 1,
+	}
+}
+
+// countsLen returns the number of counts needed by b.
+func (b *buckets) countsLen() int {
+	return int(b.bucketCount+1) * int(b.subHalfCount)
+}
+
+// Init initializes the Hist with the given Config.
+func (h *Hist) Init(cfg Config) {
+	h.initCounts(cfg, nil)
+}
+
+// initCounts is like Init but reuses counts if it is large enough.
+func (h *Hist) initCounts(cfg Config, counts []int64) {
+	if err := cfg.validate(); err != nil {
+		panic(err.Error())
+	}
+	if cfg.HighestTrackable < 2*cfg.LowestDiscernible {
+		cfg.HighestTrackable = 2 * cfg.LowestDiscernible
+	}
+	h.cfg = cfg
+	h.b = cfg.layout()
+	n := h.b.countsLen()
+	if cap(counts) < n {
+		counts = make([]int64, n)
+	} else {
+		counts = counts[:n]
+		for i := range counts {
+			counts[i] = 0
+		}
+	}
+	h.b.counts = counts
 }
 
 func (h *Hist) resize(highest int64) {
@@ -153,7 +226,7 @@ func numBucketsToCoverVal(v int64, subCount, unitMag int32) int32 {
 	smallestUntrackable := int64(subCount) << uint64(unitMag)
 
 	req := int32(1)
-	for smallestUntrackable < v {
+	for smallestUntrackable <= v {
 		if smallestUntrackable > math.MaxInt64/2 {
 			return req + 1
 		}
@@ -219,8 +292,9 @@ func (b *buckets) areEquiv(v1, v2 int64) bool {
 }
 
 func (h *Hist) Add(o *Hist) {
+	prevTotal := h.totalCount
 	highestRecordable := h.b.highestEquiv(h.b.valueFor(len(h.b.counts) - 1))
-	if oMax := o.Max(); highestRecordable < o.Max() {
+	if oMax := o.Max(); highestRecordable < oMax {
 		if !h.cfg.AutoResize {
 			panic("other histogram has values that are too large")
 		}
@@ -241,19 +315,31 @@ func (h *Hist) Add(o *Hist) {
 		// slow path
 		for i, count := range o.b.counts {
 			if count > 0 {
-				h.RecordN(o.b.valueFor(i), count)
+				h.recordCount(o.b.valueFor(i), count)
 			}
 		}
 	}
+	if o.totalCount > 0 {
+		if prevTotal <= 0 {
+			h.min, h.max = o.min, o.max
+		} else {
+			h.widen(o.min, o.max)
+		}
+	}
+	h.sum = h.sum.add(o.sum)
 
-	if h.startTime == nil {
-		h.startTime = o.startTime
-	} else if o.startTime != nil && o.startTime.Before(*h.startTime) {
+	h.mergeTimes(o)
+	if h.tag == "" {
+		h.tag = o.tag
+	}
+}
+
+// mergeTimes widens the start and end times of h to include those of o.
+func (h *Hist) mergeTimes(o *Hist) {
+	if o.startTime.ok && (!h.startTime.ok || o.startTime.t.Before(h.startTime.t)) {
 		h.startTime = o.startTime
 	}
-	if h.endTime == nil {
-		h.endTime = o.endTime
-	} else if o.endTime != nil && h.endTime.Before(*o.endTime) {
+	if o.endTime.ok && (!h.endTime.ok || h.endTime.t.Before(o.endTime.t)) {
 		h.endTime = o.endTime
 	}
 }
@@ -272,11 +358,19 @@ func (h *Hist) Sub(o *Hist) {
 			if h.Val(v).Count < count {
 				panic("other histogram has higher count than this")
 			}
-			h.RecordN(v, -count)
+			h.recordCount(v, -count)
 		}
 	}
+	h.sum = h.sum.sub(o.sum)
+	if o.totalCount > 0 {
+		h.removed(o.min, o.max)
+	}
 }
 
+// AllVals returns the highest equivalent value and count
+// of each bucket up to the highest recorded value.
+// The iterators returned by RecordedIter, LinearIter, LogIter,
+// and PercentileIter walk h without building a slice.
 func (h *Hist) AllVals() []HistVal {
 	var vals []HistVal
 	var total int64
@@ -329,62 +423,185 @@ func (h *Hist) Val(v int64) HistVal {
 // The resulting size should not be assumed to be exact.
 // The return value is in bytes.
 func (h *Hist) EstMemSize() int {
-	return histSize + 2*timeSize + cap(h.b.counts)*8
+	return histSize + cap(h.b.counts)*8
+}
+
+// Max returns the highest equivalent value of the highest recorded value,
+// or 0 if h is empty.
+func (h *Hist) Max() int64 {
+	if h.totalCount <= 0 {
+		return 0
+	}
+	return h.b.highestEquiv(h.max)
 }
 
-func (h *Hist) Max() int64 { return h.PercentileVal(100).Value }
-func (h *Hist) Min() int64 { return h.PercentileVal(0).Value }
+// Min returns the lowest equivalent value of the lowest recorded value,
+// or 0 if h is empty.
+func (h *Hist) Min() int64 {
+	if h.totalCount <= 0 {
+		return 0
+	}
+	return h.b.lowestEquiv(h.min)
+}
+
+// ExactMax returns the highest value recorded in h, or 0 if h is empty.
+//
+// The exact minimum, maximum, and sum of the recorded values are
+// maintained as values are recorded and added, and are preserved
+// by EncodeEnvelope. When they are not known, such as for histograms
+// decoded from the HdrHistogram formats, snapshots of an AtomicHist,
+// and after values are removed by Sub or negative counts,
+// they are derived from the counts and are only as precise as the buckets.
+func (h *Hist) ExactMax() int64 {
+	if h.totalCount <= 0 {
+		return 0
+	}
+	return h.max
+}
 
+// ExactMin returns the lowest value recorded in h, or 0 if h is empty.
+// See ExactMax for when it is exact.
+func (h *Hist) ExactMin() int64 {
+	if h.totalCount <= 0 {
+		return 0
+	}
+	return h.min
+}
+
+// ExactMean returns the mean of the values recorded in h,
+// or 0 if h is empty.
+// See ExactMax for when it is exact.
+func (h *Hist) ExactMean() float64 {
+	if h.totalCount <= 0 {
+		return 0
+	}
+	return h.sum.float64() / float64(h.totalCount)
+}
+
+// Mean returns the mean of the values in h,
+// using the median equivalent value of each bucket.
+// Let ε = 10^-SigFigs / 2. Each value v of at least LowestDiscernible
+// is represented by a bucket midpoint within ε·v of it, so for such values
+// the mean is within ε·μ of the mean μ of the recorded values.
+// The sum is accumulated exactly, so Mean does not overflow.
 func (h *Hist) Mean() float64 {
-	var total int64
-	for i, count := range h.b.counts {
-		v := h.b.medianEquiv(h.b.valueFor(i))
-		total += v * count
+	if h.totalCount <= 0 {
+		return 0
 	}
-	return float64(total) / math.Max(float64(h.totalCount), 1)
+	return h.midpointSum().float64() / float64(h.totalCount)
 }
 
+// Stdev returns the population standard deviation of the values in h.
+// Using the bucket midpoints, it is within ε·√(μ²+σ²) of the standard
+// deviation σ of the recorded values, where ε is as described for Mean.
 func (h *Hist) Stdev() float64 {
-	var sum float64
-	μ := h.Mean()
+	return h.stdev(h.Mean())
+}
+
+// stdev returns the standard deviation of h given its mean μ.
+func (h *Hist) stdev(μ float64) float64 {
+	m2, _, _ := h.centralMoments(μ)
+	return math.Sqrt(m2)
+}
+
+// Variance returns the population variance of the values in h.
+// With the error δ ≤ ε·√(μ²+σ²) of Stdev,
+// it is within δ·(2σ+δ) of the variance σ² of the recorded values.
+func (h *Hist) Variance() float64 {
+	m2, _, _ := h.centralMoments(h.Mean())
+	return m2
+}
+
+// Skewness returns the skewness, E[(X-μ)³]/σ³,
+// of the values in h, or 0 if their variance is 0.
+// It is computed from the bucket midpoints like Stdev and its error
+// is of the order of ε·√(μ²+σ²)/σ, so it is less precise
+// for values that are narrowly spread relative to their magnitude.
+func (h *Hist) Skewness() float64 {
+	m2, m3, _ := h.centralMoments(h.Mean())
+	if m2 == 0 {
+		return 0
+	}
+	return m3 / (m2 * math.Sqrt(m2))
+}
+
+// Kurtosis returns the kurtosis, E[(X-μ)⁴]/σ⁴,
+// of the values in h, or 0 if their variance is 0.
+// The kurtosis of a normal distribution is 3.
+// Its error is of the same order as that of Skewness.
+func (h *Hist) Kurtosis() float64 {
+	m2, _, m4 := h.centralMoments(h.Mean())
+	if m2 == 0 {
+		return 0
+	}
+	return m4 / (m2 * m2)
+}
+
+// midpointSum returns the sum of the median equivalent values
+// of the buckets of h weighted by their counts.
+func (h *Hist) midpointSum() int128 {
+	var sum int128
+	for i, count := range h.b.counts {
+		if count != 0 {
+			sum = sum.add(mul128(h.b.medianEquiv(h.b.valueFor(i)), count))
+		}
+	}
+	return sum
+}
+
+// centralMoments returns the second, third, and fourth central moments
+// of the bucket midpoints of h given their mean μ.
+// The moments are summed with compensation so that
+// the rounding error does not grow with the number of buckets.
+func (h *Hist) centralMoments(μ float64) (m2, m3, m4 float64) {
+	if h.totalCount <= 0 {
+		return 0, 0, 0
+	}
+	var s2, s3, s4 compensatedSum
 	for i, count := range h.b.counts {
-		v := h.b.medianEquiv(h.b.valueFor(i))
-		dev := μ - float64(v)
-		sum += dev * dev * float64(count)
+		if count == 0 {
+			continue
+		}
+		dev := float64(h.b.medianEquiv(h.b.valueFor(i))) - μ
+		dev2 := dev * dev
+		c := float64(count)
+		s2.add(dev2 * c)
+		s3.add(dev2 * dev * c)
+		s4.add(dev2 * dev2 * c)
 	}
-	return math.Sqrt(sum / math.Max(float64(h.totalCount), 1))
+	n := float64(h.totalCount)
+	return s2.value() / n, s3.value() / n, s4.value() / n
+}
+
+// compensatedSum is a float64 sum using Neumaier's
+// variant of Kahan summation.
+type compensatedSum struct {
+	sum, c float64
 }
 
+func (s *compensatedSum) add(x float64) {
+	t := s.sum + x
+	if math.Abs(s.sum) >= math.Abs(x) {
+		s.c += (s.sum - t) + x
+	} else {
+		s.c += (x - t) + s.sum
+	}
+	s.sum = t
+}
+
+func (s *compensatedSum) value() float64 { return s.sum + s.c }
+
 func (h *Hist) TotalCount() int64 { return h.totalCount }
 
 // PercentileVal returns the HistVal at the requested percentile p.
 // p should be in the range [0, 100].
 func (h *Hist) PercentileVal(p float64) HistVal {
-	p = math.Min(p, 100)
-	desiredCount := int64((p/100)*float64(h.totalCount) + 0.5)
-	if desiredCount < 1 {
-		desiredCount = 1
-	}
+	p, desiredCount := h.percentileCount(p)
 	var total int64
 	for i, count := range h.b.counts {
 		total += count
 		if total >= desiredCount {
-			v := h.b.valueFor(i)
-			if p == 0 {
-				v = h.b.lowestEquiv(v)
-			} else {
-				v = h.b.highestEquiv(v)
-			}
-			percentile := (100 * float64(total)) / float64(h.totalCount)
-			if h.totalCount == 0 {
-				percentile = 100
-			}
-			return HistVal{
-				Value:      v,
-				Count:      count,
-				CumCount:   total,
-				Percentile: percentile,
-			}
+			return h.percentileVal(p, i, count, total)
 		}
 	}
 	return HistVal{
@@ -395,28 +612,191 @@ func (h *Hist) PercentileVal(p float64) HistVal {
 	}
 }
 
-func (h *Hist) StartTime() (time.Time, bool) {
-	if h.startTime != nil {
-		return *h.startTime, true
+// percentileCount clamps p and returns the count of values
+// at or below percentile p.
+func (h *Hist) percentileCount(p float64) (float64, int64) {
+	p = math.Min(p, 100)
+	desiredCount := int64((p/100)*float64(h.totalCount) + 0.5)
+	if desiredCount < 1 {
+		desiredCount = 1
+	}
+	return p, desiredCount
+}
+
+// percentileVal returns the HistVal for percentile p,
+// which is reached at counts index i with a cumulative count of total.
+func (h *Hist) percentileVal(p float64, i int, count, total int64) HistVal {
+	v := h.b.valueFor(i)
+	if p == 0 {
+		v = h.b.lowestEquiv(v)
+	} else {
+		v = h.b.highestEquiv(v)
+	}
+	percentile := (100 * float64(total)) / float64(h.totalCount)
+	if h.totalCount == 0 {
+		percentile = 100
+	}
+	return HistVal{
+		Value:      v,
+		Count:      count,
+		CumCount:   total,
+		Percentile: percentile,
+	}
+}
+
+// PercentileVals returns the HistVal at each of the percentiles ps,
+// in the order of ps.
+// The results are the same as those of PercentileVal,
+// but are computed with a single pass over h.
+func (h *Hist) PercentileVals(ps []float64) []HistVal {
+	vals := make([]HistVal, len(ps))
+	h.percentileVals(ps, vals, nil)
+	return vals
+}
+
+// percentileVals stores the HistVal of each of ps in vals.
+// If mean is non-nil, it is set to the mean of h, computed
+// in the same pass.
+func (h *Hist) percentileVals(ps []float64, vals []HistVal, mean *float64) {
+	targets := make(percentileTargets, len(ps))
+	for i, p := range ps {
+		targets[i].i = i
+		targets[i].p, targets[i].count = h.percentileCount(p)
+	}
+	sort.Stable(targets)
+
+	var total int64
+	var sum int128
+	for i, count := range h.b.counts {
+		if len(targets) == 0 && mean == nil {
+			break
+		}
+		total += count
+		if mean != nil && count != 0 {
+			sum = sum.add(mul128(h.b.medianEquiv(h.b.valueFor(i)), count))
+		}
+		for len(targets) > 0 && total >= targets[0].count {
+			t := targets[0]
+			vals[t.i] = h.percentileVal(t.p, i, count, total)
+			targets = targets[1:]
+		}
+	}
+	if mean != nil {
+		*mean = 0
+		if h.totalCount > 0 {
+			*mean = sum.float64() / float64(h.totalCount)
+		}
+	}
+}
+
+// percentileTargets sorts percentiles by the counts at which they are reached.
+type percentileTargets []struct {
+	i     int // index in the requested percentiles
+	p     float64
+	count int64
+}
+
+func (t percentileTargets) Len() int           { return len(t) }
+func (t percentileTargets) Less(i, j int) bool { return t[i].count < t[j].count }
+func (t percentileTargets) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// A HistSummary summarizes the distribution of a Hist.
+type HistSummary struct {
+	TotalCount  int64
+	Min         int64
+	Max         int64
+	Mean        float64
+	Stdev       float64
+	Percentiles []HistVal // in the order requested
+}
+
+// Summary returns the summary statistics of h and its values
+// at the percentiles ps.
+// The results are the same as those of Min, Max, Mean, Stdev,
+// and PercentileVal, but are computed with fewer passes over h.
+func (h *Hist) Summary(ps []float64) HistSummary {
+	vals := make([]HistVal, len(ps)+2)
+	pcts := make([]float64, 0, len(ps)+2)
+	pcts = append(pcts, 0, 100)
+	pcts = append(pcts, ps...)
+	var mean float64
+	h.percentileVals(pcts, vals, &mean)
+	return HistSummary{
+		TotalCount:  h.totalCount,
+		Min:         vals[0].Value,
+		Max:         vals[1].Value,
+		Mean:        mean,
+		Stdev:       h.stdev(mean),
+		Percentiles: vals[2:],
+	}
+}
+
+func (h *Hist) StartTime() (time.Time, bool) { return h.startTime.t, h.startTime.ok }
+func (h *Hist) EndTime() (time.Time, bool)   { return h.endTime.t, h.endTime.ok }
+
+// optTime is a time that may be unset.
+// Times are stored by value so that setting them does not allocate.
+type optTime struct {
+	t  time.Time
+	ok bool
+}
+
+// ConversionRatio returns the integer to double value conversion ratio
+// of the histogram.
+// Hists produced by HdrHistogram's DoubleHistogram, for example,
+// record value v as v/ConversionRatio().
+// It is 1 unless set by SetConversionRatio or by decoding a histogram.
+func (h *Hist) ConversionRatio() float64 {
+	if h.f64Ratio == 0 {
+		return 1
 	}
-	return time.Time{}, false
+	return h.f64Ratio
 }
 
-func (h *Hist) EndTime() (time.Time, bool) {
-	if h.endTime != nil {
-		return *h.endTime, true
+// SetConversionRatio sets the integer to double value conversion ratio.
+// It is written when encoding h but does not affect the recorded values.
+// r must be positive and finite.
+func (h *Hist) SetConversionRatio(r float64) {
+	if !validConversionRatio(r) {
+		panic("conversion ratio must be positive and finite")
 	}
-	return time.Time{}, false
+	h.f64Ratio = r
+}
+
+func validConversionRatio(r float64) bool {
+	return r > 0 && !math.IsInf(r, 0) && !math.IsNaN(r)
 }
 
-func (h *Hist) SetStartTime(t time.Time) { h.startTime = &t }
-func (h *Hist) SetEndTime(t time.Time)   { h.endTime = &t }
+// Tag returns the tag of the histogram, or "" if it has none.
+// Tags identify the source of histograms in logs
+// that contain multiple streams of histograms.
+func (h *Hist) Tag() string { return h.tag }
+
+func (h *Hist) SetTag(tag string)        { h.tag = tag }
+func (h *Hist) SetStartTime(t time.Time) { h.startTime = optTime{t, true} }
+func (h *Hist) SetEndTime(t time.Time)   { h.endTime = optTime{t, true} }
 func (h *Hist) SetAutoResize(b bool)     { h.cfg.AutoResize = b }
 func (h *Hist) Config() Config           { return h.cfg }
 
 func (h *Hist) Record(v int64) { h.RecordN(v, 1) }
 
 func (h *Hist) RecordN(v, count int64) {
+	prevTotal := h.totalCount
+	h.recordCount(v, count)
+	h.sum = h.sum.add(mul128(v, count))
+	switch {
+	case count > 0 && prevTotal <= 0:
+		h.min, h.max = v, v
+	case count > 0:
+		h.widen(v, v)
+	case count < 0:
+		h.removed(v, v)
+	}
+}
+
+// recordCount adds count to the bucket of v
+// without updating the min, max, and sum of h.
+func (h *Hist) recordCount(v, count int64) {
 	i := h.b.countsIndex(v)
 	if i >= len(h.b.counts) && h.cfg.AutoResize {
 		h.resize(v)
@@ -437,61 +817,141 @@ func (h *Hist) RecordCorrected(v int64, expectedInterval int64) {
 	}
 }
 
-// Clear deletes all recorded values as well as the start and end times.
+// Clear deletes all recorded values as well as the start and end times and the tag.
 func (h *Hist) Clear() {
 	for i := range h.b.counts {
 		h.b.counts[i] = 0
 	}
 	h.totalCount = 0
-	h.startTime = nil
-	h.endTime = nil
+	h.min, h.max = 0, 0
+	h.sum = int128{}
+	h.startTime = optTime{}
+	h.endTime = optTime{}
+	h.tag = ""
 }
 
-// Recorder provides a recording-only convenience API for snapshotting Hists.
-type Recorder struct {
-	h Hist
+// widen extends the recorded range of h to include [lo, hi].
+func (h *Hist) widen(lo, hi int64) {
+	if lo < h.min {
+		h.min = lo
+	}
+	if hi > h.max {
+		h.max = hi
+	}
 }
 
-func NewRecorder(sigfigs int32) *Recorder {
-	return NewRecorderWithConfig(Config{
-		LowestDiscernible: 1,
-		HighestTrackable:  2,
-		SigFigs:           sigfigs,
-		AutoResize:        true,
-	})
+// removed updates the min and max of h after values
+// in [lo, hi] have been removed from its counts.
+// Values removed at the ends of the recorded range are replaced
+// by the bounds of the lowest and highest nonzero buckets.
+func (h *Hist) removed(lo, hi int64) {
+	if h.totalCount <= 0 {
+		h.min, h.max = 0, 0
+		h.sum = int128{}
+		return
+	}
+	if lo <= h.min || h.b.areEquiv(lo, h.min) {
+		if v := h.b.lowestEquiv(h.b.valueFor(h.firstNonZero())); v > h.min {
+			h.min = v
+		}
+	}
+	if hi >= h.max || h.b.areEquiv(hi, h.max) {
+		if v := h.b.highestEquiv(h.b.valueFor(h.lastNonZero())); v < h.max {
+			h.max = v
+		}
+	}
 }
 
-func NewRecorderWithConfig(cfg Config) *Recorder {
-	var r Recorder
-	r.Init(cfg)
-	return &r
+// statsFromBuckets sets the min, max, and sum of h
+// from its counts, for when the recorded values are not known.
+// The sum uses the median equivalent value of each bucket.
+func (h *Hist) statsFromBuckets() {
+	h.min, h.max = 0, 0
+	h.sum = int128{}
+	if h.totalCount <= 0 {
+		return
+	}
+	h.sum = h.midpointSum()
+	h.min = h.b.lowestEquiv(h.b.valueFor(h.firstNonZero()))
+	h.max = h.b.highestEquiv(h.b.valueFor(h.lastNonZero()))
 }
 
-func (r *Recorder) Init(cfg Config) {
-	r.h.Init(cfg)
-	r.h.SetStartTime(time.Now())
+// firstNonZero returns the index of the first nonzero count,
+// or 0 if there is none.
+func (h *Hist) firstNonZero() int {
+	for i, count := range h.b.counts {
+		if count != 0 {
+			return i
+		}
+	}
+	return 0
 }
 
-func (r *Recorder) Clear()                 { r.h.Clear() }
-func (r *Recorder) Record(v int64)         { r.h.Record(v) }
-func (r *Recorder) RecordN(v, count int64) { r.h.RecordN(v, count) }
-func (r *Recorder) RecordCorrected(v int64, expectedInterval int64) {
-	r.h.RecordCorrected(v, expectedInterval)
+// lastNonZero returns the index of the last nonzero count,
+// or 0 if there is none.
+func (h *Hist) lastNonZero() int {
+	for i := len(h.b.counts) - 1; i > 0; i-- {
+		if h.b.counts[i] != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// shiftLeft multiplies all recorded values by 2^k.
+// The histogram is not modified if any value would no longer be trackable.
+func (h *Hist) shiftLeft(k uint) error {
+	maxi := -1
+	for i, count := range h.b.counts {
+		if count != 0 {
+			maxi = i
+		}
+	}
+	if maxi <= 0 {
+		// no non-zero values to shift
+		return nil
+	}
+	v := h.b.valueFor(maxi)
+	if k >= 63 || v > math.MaxInt64>>k || h.b.countsIndex(v<<k) >= len(h.b.counts) {
+		return errors.New("shift would overflow histogram")
+	}
+	h.shift(func(v int64) int64 { return v << k })
+	h.min, h.max = h.min<<k, h.max<<k
+	h.sum = h.sum.shl(k)
+	return nil
 }
 
-func (r *Recorder) IntervalHist(h *Hist) *Hist {
-	if h == nil {
-		h = &Hist{}
+// shiftRight divides all recorded values by 2^k.
+// The histogram is not modified if any value would lose precision.
+func (h *Hist) shiftRight(k uint) error {
+	mini := -1
+	for i, count := range h.b.counts[1:] {
+		if count != 0 {
+			mini = i + 1
+			break
+		}
+	}
+	if mini < 0 {
+		// no non-zero values to shift
+		return nil
 	}
-	newCounts := h.b.counts
-	*h = r.h
-	now := time.Now()
-	h.SetEndTime(now)
-	if cap(newCounts) < len(r.h.b.counts) {
-		newCounts = make([]int64, len(r.h.b.counts))
+	// a value keeps its precision if it is in a bucket with index ≥ k
+	lowestLossless := int64(h.b.subHalfCount) << (k + uint(h.b.unitMag))
+	if k >= 63 || h.b.valueFor(mini) < lowestLossless {
+		return errors.New("shift would lose precision of recorded values")
 	}
-	r.h.b.counts = newCounts[0:len(r.h.b.counts)]
-	r.h.Clear()
-	r.h.SetStartTime(now)
-	return h
+	h.shift(func(v int64) int64 { return v >> k })
+	h.min, h.max = h.min>>k, h.max>>k
+	h.sum = h.sum.sar(k)
+	return nil
+}
+
+func (h *Hist) shift(f func(int64) int64) {
+	counts := make([]int64, len(h.b.counts))
+	for i, count := range h.b.counts {
+		if count != 0 {
+			counts[h.b.countsIndex(f(h.b.valueFor(i)))] += count
+		}
+	}
+	h.b.counts = counts
 }
@@ -1,6 +1,9 @@
 package hdrhist
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func onlySigFigs(v int64, sigfigs int32) int64 {
 	var stack [20]int8
@@ -117,3 +120,219 @@ func TestValOOB(t *testing.T) {
 		}
 	}
 }
+
+func TestRecordAtBucketBoundary(t *testing.T) {
+	// The smallest value that doesn't fit in the first bucket,
+	// subCount<<unitMag, needs a bucket of its own.
+	h := New(3)
+	h.Record(2048)
+	if got := h.Max(); got != h.b.highestEquiv(2048) {
+		t.Errorf("auto-resized: got max %d, want %d", got, h.b.highestEquiv(2048))
+	}
+
+	for _, cfg := range []Config{
+		{LowestDiscernible: 1, SigFigs: 1},
+		{LowestDiscernible: 1, SigFigs: 3},
+		{LowestDiscernible: 1000, SigFigs: 2},
+	} {
+		cfg.HighestTrackable = 2 * cfg.LowestDiscernible
+		b := WithConfig(cfg).b
+		v := int64(b.subCount) << uint(b.unitMag)
+		cfg.HighestTrackable = v
+		h := WithConfig(cfg)
+		h.Record(v)
+		if got := h.Val(v).Count; got != 1 {
+			t.Errorf("%+v: got count %d at %d, want 1", cfg, got, v)
+		}
+	}
+}
+
+func TestPercentileVals(t *testing.T) {
+	ps := []float64{99, 50, 0, 100, 99.9, 50, -1, 150, 99.999, 0.001, 75}
+	empty := New(3)
+	h := New(3)
+	for v := int64(1); v < 1000000; v = v*5/4 + 1 {
+		h.RecordN(v, v%7+1)
+	}
+	for _, h := range []*Hist{empty, h} {
+		vals := h.PercentileVals(ps)
+		if len(vals) != len(ps) {
+			t.Fatalf("got %d vals, want %d", len(vals), len(ps))
+		}
+		for i, p := range ps {
+			if want := h.PercentileVal(p); vals[i] != want {
+				t.Errorf("count %d: p%v: got %+v, want %+v", h.TotalCount(), p, vals[i], want)
+			}
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	h := New(3)
+	for v := int64(1); v < 1000000; v = v*5/4 + 1 {
+		h.RecordN(v, v%7+1)
+	}
+	ps := []float64{50, 99, 99.9}
+	s := h.Summary(ps)
+	if s.TotalCount != h.TotalCount() || s.Min != h.Min() || s.Max != h.Max() {
+		t.Errorf("got count %d min %d max %d, want %d, %d, %d", s.TotalCount, s.Min, s.Max, h.TotalCount(), h.Min(), h.Max())
+	}
+	if s.Mean != h.Mean() || s.Stdev != h.Stdev() {
+		t.Errorf("got mean %v stdev %v, want %v, %v", s.Mean, s.Stdev, h.Mean(), h.Stdev())
+	}
+	for i, p := range ps {
+		if want := h.PercentileVal(p); s.Percentiles[i] != want {
+			t.Errorf("p%v: got %+v, want %+v", p, s.Percentiles[i], want)
+		}
+	}
+}
+
+func TestExactStats(t *testing.T) {
+	check := func(name string, h *Hist, min, max int64, mean float64) {
+		if h.ExactMin() != min || h.ExactMax() != max || h.ExactMean() != mean {
+			t.Errorf("%s: got min %d max %d mean %v, want %d, %d, %v",
+				name, h.ExactMin(), h.ExactMax(), h.ExactMean(), min, max, mean)
+		}
+		if got, want := h.Min(), h.PercentileVal(0).Value; got != want {
+			t.Errorf("%s: got Min %d, want %d", name, got, want)
+		}
+		if got, want := h.Max(), h.PercentileVal(100).Value; got != want {
+			t.Errorf("%s: got Max %d, want %d", name, got, want)
+		}
+	}
+
+	h := New(2)
+	check("empty", h, 0, 0, 0)
+	h.Record(1001)
+	h.RecordN(12345, 2)
+	h.Record(99999)
+	check("recorded", h, 1001, 99999, 31422.5)
+
+	o := New(3)
+	o.RecordN(3, 3)
+	o.Record(1000001)
+	h.Add(o)
+	check("added", h, 3, 1000001, (1001+2*12345+99999+3*3+1000001)/8.0)
+
+	var empty Hist
+	empty.Init(Config{LowestDiscernible: 1, HighestTrackable: 2, SigFigs: 3, AutoResize: true})
+	empty.Add(o)
+	check("added to empty", &empty, 3, 1000001, (3*3+1000001)/4.0)
+
+	// Removing the min or max falls back to the bucket bounds.
+	h.Sub(o)
+	check("subtracted", h, h.b.lowestEquiv(1001), h.b.highestEquiv(99999), 31422.5)
+	h.RecordN(1001, -1)
+	h.RecordN(99999, -1)
+	check("removed", h, h.b.lowestEquiv(12345), h.b.highestEquiv(12345), 12345)
+
+	h.Clear()
+	check("cleared", h, 0, 0, 0)
+
+	// The sum does not overflow int64.
+	h.RecordN(math.MaxInt64/2, 1<<40)
+	h.Record(0)
+	check("large", h, 0, math.MaxInt64/2, float64(math.MaxInt64/2)*(1<<40)/(1<<40+1))
+}
+
+func TestMoments(t *testing.T) {
+	// Values below the sub bucket count are recorded exactly.
+	h := New(3)
+	const n = 1000
+	for v := int64(1); v <= n; v++ {
+		h.Record(v)
+	}
+	variance := (n*n - 1) / 12.0
+	kurtosis := 3 - 6*(n*n+1)/(5*(n*n-1.0))
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"mean", h.Mean(), (n + 1) / 2.0},
+		{"variance", h.Variance(), variance},
+		{"stdev", h.Stdev(), math.Sqrt(variance)},
+		{"skewness", h.Skewness(), 0},
+		{"kurtosis", h.Kurtosis(), kurtosis},
+	} {
+		if math.Abs(c.got-c.want) > 1e-12*math.Max(1, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	var empty Hist
+	empty.Init(Config{LowestDiscernible: 1, HighestTrackable: 2, SigFigs: 3})
+	empty.Record(5)
+	if v, s, k := empty.Variance(), empty.Skewness(), empty.Kurtosis(); v != 0 || s != 0 || k != 0 {
+		t.Errorf("single value: got variance %v skewness %v kurtosis %v, want 0", v, s, k)
+	}
+}
+
+func TestMomentsErrorBound(t *testing.T) {
+	for sigfigs := int32(1); sigfigs <= 4; sigfigs++ {
+		h := New(sigfigs)
+		var vals []float64
+		for i := int64(1); i <= 2000; i++ {
+			h.RecordN(i*i*i, i%3+1)
+			for j := int64(0); j < i%3+1; j++ {
+				vals = append(vals, float64(i*i*i))
+			}
+		}
+		var μ, m2, m3, m4 float64
+		for _, v := range vals {
+			μ += v
+		}
+		μ /= float64(len(vals))
+		for _, v := range vals {
+			d := v - μ
+			m2 += d * d
+			m3 += d * d * d
+			m4 += d * d * d * d
+		}
+		m2 /= float64(len(vals))
+		m3 /= float64(len(vals))
+		m4 /= float64(len(vals))
+		σ := math.Sqrt(m2)
+
+		ε := math.Pow(10, -float64(sigfigs)) / 2
+		δ := ε * math.Sqrt(μ*μ+m2)
+		if got := h.Mean(); math.Abs(got-μ) > ε*μ {
+			t.Errorf("sigfigs %d: got mean %v, want %v ± %v", sigfigs, got, μ, ε*μ)
+		}
+		if got := h.Stdev(); math.Abs(got-σ) > δ {
+			t.Errorf("sigfigs %d: got stdev %v, want %v ± %v", sigfigs, got, σ, δ)
+		}
+		if got := h.Variance(); math.Abs(got-m2) > δ*(2*σ+δ) {
+			t.Errorf("sigfigs %d: got variance %v, want %v ± %v", sigfigs, got, m2, δ*(2*σ+δ))
+		}
+		tol := 10 * δ / σ
+		if got, want := h.Skewness(), m3/(m2*σ); math.Abs(got-want) > tol*math.Max(1, want) {
+			t.Errorf("sigfigs %d: got skewness %v, want %v", sigfigs, got, want)
+		}
+		if got, want := h.Kurtosis(), m4/(m2*m2); math.Abs(got-want) > tol*want {
+			t.Errorf("sigfigs %d: got kurtosis %v, want %v", sigfigs, got, want)
+		}
+	}
+}
+
+func TestMeanOverflow(t *testing.T) {
+	// The sums of these values overflow int64.
+	h := New(3)
+	h.RecordN(1<<50, 1<<20)
+	h.RecordN(3<<50, 1<<20)
+	ε := math.Pow(10, -3) / 2
+	if got, want := h.Mean(), float64(2<<50); math.Abs(got-want) > ε*want {
+		t.Errorf("got mean %v, want %v", got, want)
+	}
+	if got, want := h.Stdev(), float64(1<<50); math.Abs(got-want) > 3*ε*want {
+		t.Errorf("got stdev %v, want %v", got, want)
+	}
+	if got := h.Skewness(); math.Abs(got) > 0.01 {
+		t.Errorf("got skewness %v, want 0", got)
+	}
+	if got := h.Kurtosis(); math.Abs(got-1) > 0.01 {
+		t.Errorf("got kurtosis %v, want 1", got)
+	}
+	if s := h.Summary(nil); s.Mean != h.Mean() {
+		t.Errorf("got summary mean %v, want %v", s.Mean, h.Mean())
+	}
+}
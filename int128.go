@@ -0,0 +1,102 @@
+package hdrhist
+
+import "math"
+
+// int128 is a two's complement 128-bit integer.
+// It is used to accumulate sums of recorded values without overflow.
+type int128 struct {
+	hi int64
+	lo uint64
+}
+
+func (a int128) add(b int128) int128 {
+	lo := a.lo + b.lo
+	var carry int64
+	if lo < a.lo {
+		carry = 1
+	}
+	return int128{a.hi + b.hi + carry, lo}
+}
+
+func (a int128) neg() int128 {
+	lo := ^a.lo + 1
+	hi := ^a.hi
+	if lo == 0 {
+		hi++
+	}
+	return int128{hi, lo}
+}
+
+func (a int128) sub(b int128) int128 { return a.add(b.neg()) }
+
+// cmp returns -1, 0, or 1 if a is less than, equal to, or greater than b.
+func (a int128) cmp(b int128) int {
+	switch {
+	case a.hi < b.hi:
+		return -1
+	case a.hi > b.hi:
+		return 1
+	case a.lo < b.lo:
+		return -1
+	case a.lo > b.lo:
+		return 1
+	}
+	return 0
+}
+
+// mul128 returns the 128-bit product of a and b.
+func mul128(a, b int64) int128 {
+	if -1<<31 <= a && a < 1<<31 && -1<<31 <= b && b < 1<<31 {
+		p := a * b
+		return int128{p >> 63, uint64(p)}
+	}
+	neg := (a < 0) != (b < 0)
+	ua, ub := uint64(a), uint64(b)
+	if a < 0 {
+		ua = -ua
+	}
+	if b < 0 {
+		ub = -ub
+	}
+	hi, lo := mulU64(ua, ub)
+	p := int128{int64(hi), lo}
+	if neg {
+		return p.neg()
+	}
+	return p
+}
+
+// mulU64 returns the 128-bit product of x and y as (hi, lo).
+func mulU64(x, y uint64) (hi, lo uint64) {
+	const mask32 = 1<<32 - 1
+	x0, x1 := x&mask32, x>>32
+	y0, y1 := y&mask32, y>>32
+	w0 := x0 * y0
+	t := x1*y0 + w0>>32
+	w1 := t&mask32 + x0*y1
+	hi = x1*y1 + t>>32 + w1>>32
+	return hi, x * y
+}
+
+// shl returns a<<k for k < 64.
+func (a int128) shl(k uint) int128 {
+	if k == 0 {
+		return a
+	}
+	return int128{a.hi<<k | int64(a.lo>>(64-k)), a.lo << k}
+}
+
+// sar returns a>>k, rounded towards negative infinity, for k < 64.
+func (a int128) sar(k uint) int128 {
+	if k == 0 {
+		return a
+	}
+	return int128{a.hi >> k, a.lo>>k | uint64(a.hi)<<(64-k)}
+}
+
+func (a int128) float64() float64 {
+	if a.hi < 0 {
+		return -a.neg().float64()
+	}
+	return float64(a.hi)*math.Exp2(64) + float64(a.lo)
+}
@@ -0,0 +1,47 @@
+package hdrhist
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func (a int128) big() *big.Int {
+	b := new(big.Int).Lsh(big.NewInt(a.hi), 64)
+	return b.Add(b, new(big.Int).SetUint64(a.lo))
+}
+
+func TestInt128(t *testing.T) {
+	vals := []int64{0, 1, -1, 3, -7, 1 << 31, -1 << 31, 1<<31 - 1, 1 << 40, -12345678901, math.MaxInt64, math.MinInt64}
+	for _, a := range vals {
+		for _, b := range vals {
+			p := mul128(a, b)
+			want := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+			if p.big().Cmp(want) != 0 {
+				t.Errorf("%d * %d: got %v, want %v", a, b, p.big(), want)
+			}
+			q := mul128(b, 3)
+			if got, want := p.add(q).big(), new(big.Int).Add(p.big(), q.big()); got.Cmp(want) != 0 {
+				t.Errorf("%v + %v: got %v, want %v", p.big(), q.big(), got, want)
+			}
+			if got, want := p.sub(q).big(), new(big.Int).Sub(p.big(), q.big()); got.Cmp(want) != 0 {
+				t.Errorf("%v - %v: got %v, want %v", p.big(), q.big(), got, want)
+			}
+			if got, want := p.cmp(q), p.big().Cmp(q.big()); got != want {
+				t.Errorf("cmp(%v, %v): got %d, want %d", p.big(), q.big(), got, want)
+			}
+			if got, want := p.sar(5).big(), new(big.Int).Rsh(p.big(), 5); got.Cmp(want) != 0 {
+				t.Errorf("%v >> 5: got %v, want %v", p.big(), got, want)
+			}
+			if a>>20 == 0 || ^a>>20 == 0 {
+				if got, want := p.shl(3).big(), new(big.Int).Lsh(p.big(), 3); got.Cmp(want) != 0 {
+					t.Errorf("%v << 3: got %v, want %v", p.big(), got, want)
+				}
+			}
+			f, _ := new(big.Float).SetInt(p.big()).Float64()
+			if got := p.float64(); math.Abs(got-f) > math.Abs(f)*1e-15 {
+				t.Errorf("float64(%v): got %v, want %v", p.big(), got, f)
+			}
+		}
+	}
+}
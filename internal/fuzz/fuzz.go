@@ -6,12 +6,39 @@ import (
 	"github.com/uluyol/hdrhist"
 )
 
+// limits are small enough that hostile inputs can't exhaust memory
+// while still admitting the histograms in the corpus.
+var limits = hdrhist.DecodeOptions{
+	MaxCountsLen:         1 << 20,
+	MaxDecompressedBytes: 8 << 20,
+	MaxTotalCount:        1 << 50,
+}
+
 func Fuzz(data []byte) int {
 	r := bytes.NewReader(data)
 	lr := hdrhist.NewLogReader(r)
+	lr.SetDecodeOptions(limits)
 	for lr.Scan() {
 		_ = lr.Hist()
 	}
 	_ = lr.Err()
-	return 0
+
+	ret := 0
+	r = bytes.NewReader(data)
+	for {
+		h, err := limits.Decode(r)
+		if err != nil {
+			break
+		}
+		if h.TotalCount() > limits.MaxTotalCount {
+			panic("decoded hist exceeds MaxTotalCount")
+		}
+		ret = 1
+	}
+
+	var d hdrhist.DoubleHist
+	if d.UnmarshalBinary(data) == nil {
+		ret = 1
+	}
+	return ret
 }
@@ -0,0 +1,152 @@
+package hdrhist
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// A Clock provides the time to an IntervalLogger.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// A Ticker delivers ticks of a Clock at intervals.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is a Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// IntervalLoggerConfig configures an IntervalLogger.
+type IntervalLoggerConfig struct {
+	// Interval is the length of each logged interval.
+	Interval time.Duration
+
+	// Hist is the Config of the recorded histograms.
+	Hist Config
+
+	// Log configures the written log.
+	// If Log.StartTime is zero, the time the IntervalLogger
+	// is created is used.
+	Log LogWriterConfig
+
+	// Clock is used to time intervals. Nil means SystemClock.
+	Clock Clock
+
+	// OnError is called with errors that occur
+	// while writing intervals in the background.
+	// It is called from a goroutine owned by the IntervalLogger.
+	OnError func(error)
+}
+
+// IntervalLogger records values into a Recorder and periodically
+// writes the values recorded during each interval to a log.
+//
+// Record, RecordN, and RecordCorrected are safe for concurrent use.
+type IntervalLogger struct {
+	rec   Recorder
+	w     *LogWriter
+	h     *Hist // reused between intervals
+	clock Clock
+	start time.Time
+
+	onError func(error)
+	ticker  Ticker
+	stop    chan struct{}
+	done    chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewIntervalLogger creates an IntervalLogger that writes to w
+// and starts logging intervals in the background.
+// Close must be called to stop logging.
+func NewIntervalLogger(w io.Writer, cfg IntervalLoggerConfig) *IntervalLogger {
+	if cfg.Interval <= 0 {
+		panic("invalid IntervalLoggerConfig: Interval must be > 0")
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	l := &IntervalLogger{
+		clock:   cfg.Clock,
+		onError: cfg.OnError,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	l.rec.Init(cfg.Hist)
+	l.start = l.clock.Now()
+	if cfg.Log.StartTime.IsZero() {
+		cfg.Log.StartTime = l.start
+	}
+	l.w = NewLogWriterWithConfig(w, cfg.Log)
+	l.ticker = l.clock.NewTicker(cfg.Interval)
+	go l.run()
+	return l
+}
+
+func (l *IntervalLogger) Record(v int64)         { l.rec.Record(v) }
+func (l *IntervalLogger) RecordN(v, count int64) { l.rec.RecordN(v, count) }
+
+func (l *IntervalLogger) RecordCorrected(v int64, expectedInterval int64) {
+	l.rec.RecordCorrected(v, expectedInterval)
+}
+
+// SetTag sets the tag of subsequently logged intervals.
+func (l *IntervalLogger) SetTag(tag string) { l.rec.SetTag(tag) }
+
+func (l *IntervalLogger) run() {
+	defer close(l.done)
+	for {
+		select {
+		case <-l.ticker.C():
+			if err := l.writeInterval(); err != nil && l.onError != nil {
+				l.onError(err)
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// writeInterval writes the values recorded since the previous interval.
+// The interval bounds are taken from the clock of l.
+func (l *IntervalLogger) writeInterval() error {
+	l.h = l.rec.IntervalHist(l.h)
+	now := l.clock.Now()
+	l.h.SetStartTime(l.start)
+	l.h.SetEndTime(now)
+	l.start = now
+	return l.w.Write(l.h)
+}
+
+// Close stops logging and writes the values recorded
+// since the last interval, returning any error doing so.
+// Values recorded after Close are not logged.
+func (l *IntervalLogger) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		l.ticker.Stop()
+		l.closeErr = l.writeInterval()
+	})
+	return l.closeErr
+}
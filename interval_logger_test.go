@@ -0,0 +1,162 @@
+package hdrhist
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+	c   chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, c: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker { return c }
+func (c *fakeClock) C() <-chan time.Time              { return c.c }
+func (c *fakeClock) Stop()                            {}
+
+// tick advances the clock by d and delivers a tick.
+// It returns once the tick has been received,
+// which happens after any previous tick has been handled.
+func (c *fakeClock) tick(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.c <- now
+}
+
+// histWriter collects a log and signals each histogram line written.
+type histWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	hists chan struct{}
+}
+
+func (w *histWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	n, err := w.buf.Write(p)
+	w.mu.Unlock()
+	if len(p) > 0 && p[0] != '#' && p[0] != '"' {
+		w.hists <- struct{}{}
+	}
+	return n, err
+}
+
+var testLoggerConfig = Config{
+	LowestDiscernible: 1,
+	HighestTrackable:  1000,
+	SigFigs:           3,
+}
+
+func TestIntervalLogger(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	clock := newFakeClock(start)
+	w := &histWriter{hists: make(chan struct{}, 3)}
+	l := NewIntervalLogger(w, IntervalLoggerConfig{
+		Interval: time.Second,
+		Hist:     testLoggerConfig,
+		Clock:    clock,
+		OnError:  func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+
+	l.Record(1)
+	clock.tick(time.Second)
+	<-w.hists
+	l.RecordN(2, 2)
+	clock.tick(time.Second)
+	<-w.hists
+	l.SetTag("last")
+	l.Record(3)
+	clock.mu.Lock()
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	clock.mu.Unlock()
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	l.Record(4) // not logged
+
+	lr := NewLogReader(&w.buf)
+	if st, ok := lr.StartTime(); ok {
+		t.Errorf("start time available before Scan: %v", st)
+	}
+	want := []struct {
+		v, count int64
+		tag      string
+		start    time.Duration
+		end      time.Duration
+	}{
+		{1, 1, "", 0, time.Second},
+		{2, 2, "", time.Second, 2 * time.Second},
+		{3, 1, "last", 2 * time.Second, 2500 * time.Millisecond},
+	}
+	i := 0
+	for ; lr.Scan(); i++ {
+		if i >= len(want) {
+			t.Fatalf("too many intervals")
+		}
+		w := want[i]
+		h := lr.Hist()
+		if h.TotalCount() != w.count || h.Max() != w.v {
+			t.Errorf("interval %d: got count %d max %d, want %d, %d", i, h.TotalCount(), h.Max(), w.count, w.v)
+		}
+		if h.Tag() != w.tag {
+			t.Errorf("interval %d: got tag %q, want %q", i, h.Tag(), w.tag)
+		}
+		hs, _ := h.StartTime()
+		he, _ := h.EndTime()
+		if !hs.Equal(start.Add(w.start)) || !he.Equal(start.Add(w.end)) {
+			t.Errorf("interval %d: got times %v-%v, want %v-%v", i, hs, he, start.Add(w.start), start.Add(w.end))
+		}
+	}
+	if err := lr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(want) {
+		t.Errorf("got %d intervals, want %d", i, len(want))
+	}
+	if st, ok := lr.StartTime(); !ok || !st.Equal(start) {
+		t.Errorf("got start time %v, want %v", st, start)
+	}
+}
+
+type failWriter struct{ err error }
+
+func (w failWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestIntervalLoggerErrors(t *testing.T) {
+	errWrite := errors.New("write failed")
+	clock := newFakeClock(time.Unix(1500000000, 0))
+	var errs []error
+	l := NewIntervalLogger(failWriter{errWrite}, IntervalLoggerConfig{
+		Interval: time.Second,
+		Hist:     testLoggerConfig,
+		Clock:    clock,
+		OnError:  func(err error) { errs = append(errs, err) },
+	})
+	clock.tick(time.Second)
+	clock.tick(time.Second)
+	if err := l.Close(); err == nil {
+		t.Error("Close: got nil error")
+	}
+	// Close waits for the logging goroutine, so errs is safe to read.
+	if len(errs) != 2 {
+		t.Errorf("got %d errors, want 2: %v", len(errs), errs)
+	}
+}
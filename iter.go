@@ -0,0 +1,251 @@
+package hdrhist
+
+import "math"
+
+// HistIterVal is a step of a HistIter.
+//
+// The embedded HistVal describes the value iterated to:
+// Value is the highest value of the step, Count is the count of
+// the bucket at Value, and CumCount and Percentile describe
+// all values up to and including Value.
+type HistIterVal struct {
+	HistVal
+
+	// ValueFrom is the Value of the previous step, or 0.
+	// The step covers the values in (ValueFrom, Value].
+	ValueFrom int64
+
+	// CountAdded is the count of the values covered by the step.
+	CountAdded int64
+
+	// PercentileLevel is the percentile iterated to by a
+	// percentile iterator, and is equal to Percentile otherwise.
+	PercentileLevel float64
+}
+
+type iterKind int
+
+const (
+	iterRecorded iterKind = iota
+	iterLinear
+	iterLog
+	iterPercentile
+)
+
+// A HistIter iterates over the values of a Hist in steps.
+// HistIters are created by the RecordedIter, LinearIter, LogIter,
+// and PercentileIter methods of Hist and are used as follows:
+//
+//	it := h.PercentileIter(5)
+//	for it.Next() {
+//	    v := it.Val()
+//	    ...
+//	}
+//
+// The Hist must not be modified during iteration.
+// Iterating does not allocate.
+type HistIter struct {
+	h     *Hist
+	kind  iterKind
+	total int64
+
+	idx          int
+	valAtIdx     int64
+	nextValAtIdx int64
+	countAtIdx   int64
+	cumToIdx     int64
+	cumToPrev    int64
+	prevValTo    int64
+	fresh        bool
+
+	visited int // recorded
+
+	step           int64   // linear
+	logBase        float64 // log
+	logNext        float64 // log
+	stepHighest    int64   // linear and log
+	stepLowest     int64   // linear and log
+	ticks          int64   // percentile
+	percentileTo   float64 // percentile
+	reachedLastVal bool    // percentile
+
+	cur HistIterVal
+}
+
+func (h *Hist) newIter(kind iterKind) HistIter {
+	return HistIter{
+		h:            h,
+		kind:         kind,
+		total:        h.totalCount,
+		nextValAtIdx: 1 << uint(h.b.unitMag),
+		fresh:        true,
+		visited:      -1,
+	}
+}
+
+// RecordedIter returns an iterator with a step
+// for each bucket that has a nonzero count.
+func (h *Hist) RecordedIter() HistIter {
+	return h.newIter(iterRecorded)
+}
+
+// LinearIter returns an iterator with steps of step value units.
+// It panics if step is not positive.
+func (h *Hist) LinearIter(step int64) HistIter {
+	if step <= 0 {
+		panic("invalid LinearIter step: must be > 0")
+	}
+	it := h.newIter(iterLinear)
+	it.step = step
+	it.stepHighest = step - 1
+	it.stepLowest = h.b.lowestEquiv(it.stepHighest)
+	return it
+}
+
+// LogIter returns an iterator with steps that grow exponentially
+// by base, starting with a step of first value units.
+// It panics if first is not positive or base is not greater than 1.
+func (h *Hist) LogIter(first int64, base float64) HistIter {
+	if first <= 0 {
+		panic("invalid LogIter first step: must be > 0")
+	}
+	if !(base > 1) {
+		panic("invalid LogIter base: must be > 1")
+	}
+	it := h.newIter(iterLog)
+	it.logBase = base
+	it.logNext = float64(first)
+	it.stepHighest = first - 1
+	it.stepLowest = h.b.lowestEquiv(it.stepHighest)
+	return it
+}
+
+// PercentileIter returns an iterator over percentile levels.
+// The number of steps is ticksPerHalfDistance for each halving of
+// the distance to 100%, so steps grow finer towards the tail,
+// and the last step is at 100%.
+// It panics if ticksPerHalfDistance is not positive.
+func (h *Hist) PercentileIter(ticksPerHalfDistance int) HistIter {
+	if ticksPerHalfDistance <= 0 {
+		panic("invalid PercentileIter ticksPerHalfDistance: must be > 0")
+	}
+	it := h.newIter(iterPercentile)
+	it.ticks = int64(ticksPerHalfDistance)
+	return it
+}
+
+// Val returns the current step.
+func (it *HistIter) Val() HistIterVal { return it.cur }
+
+// Next advances to the next step and reports whether there is one.
+func (it *HistIter) Next() bool {
+	if !it.hasNext() {
+		return false
+	}
+	counts := it.h.b.counts
+	for it.idx < len(counts) {
+		it.countAtIdx = counts[it.idx]
+		if it.fresh {
+			it.cumToIdx += it.countAtIdx
+			it.fresh = false
+		}
+		if it.reachedLevel() {
+			valTo := it.valueTo()
+			percentile := 100 * float64(it.cumToIdx) / float64(it.total)
+			level := percentile
+			if it.kind == iterPercentile {
+				level = it.percentileTo
+			}
+			it.cur = HistIterVal{
+				HistVal: HistVal{
+					Value:      valTo,
+					Count:      it.countAtIdx,
+					CumCount:   it.cumToIdx,
+					Percentile: percentile,
+				},
+				ValueFrom:       it.prevValTo,
+				CountAdded:      it.cumToIdx - it.cumToPrev,
+				PercentileLevel: level,
+			}
+			it.prevValTo = valTo
+			it.cumToPrev = it.cumToIdx
+			it.nextLevel()
+			return true
+		}
+		it.nextBucket()
+	}
+	return false
+}
+
+func (it *HistIter) hasNext() bool {
+	if it.cumToIdx < it.total {
+		return true
+	}
+	switch it.kind {
+	case iterLinear:
+		// Keep iterating while the next step is within the bucket
+		// holding the last recorded value.
+		return it.stepHighest+1 < it.nextValAtIdx
+	case iterLog:
+		return it.h.b.lowestEquiv(int64(it.logNext)) < it.nextValAtIdx
+	case iterPercentile:
+		// Take one last step to 100%.
+		if !it.reachedLastVal && it.total > 0 {
+			it.percentileTo = 100
+			it.reachedLastVal = true
+			return true
+		}
+	}
+	return false
+}
+
+func (it *HistIter) nextBucket() {
+	it.fresh = true
+	it.idx++
+	it.valAtIdx = it.h.b.valueFor(it.idx)
+	it.nextValAtIdx = it.h.b.valueFor(it.idx + 1)
+}
+
+func (it *HistIter) reachedLevel() bool {
+	switch it.kind {
+	case iterRecorded:
+		return it.countAtIdx != 0 && it.visited != it.idx
+	case iterLinear, iterLog:
+		return it.valAtIdx >= it.stepLowest || it.idx >= len(it.h.b.counts)-1
+	case iterPercentile:
+		if it.countAtIdx == 0 {
+			return false
+		}
+		return 100*float64(it.cumToIdx)/float64(it.total) >= it.percentileTo
+	}
+	panic("unreachable")
+}
+
+func (it *HistIter) valueTo() int64 {
+	switch it.kind {
+	case iterLinear, iterLog:
+		return it.stepHighest
+	}
+	return it.h.b.highestEquiv(it.valAtIdx)
+}
+
+func (it *HistIter) nextLevel() {
+	switch it.kind {
+	case iterRecorded:
+		it.visited = it.idx
+	case iterLinear:
+		it.stepHighest += it.step
+		it.stepLowest = it.h.b.lowestEquiv(it.stepHighest)
+	case iterLog:
+		it.logNext *= it.logBase
+		it.stepHighest = int64(it.logNext) - 1
+		it.stepLowest = it.h.b.lowestEquiv(it.stepHighest)
+	case iterPercentile:
+		if it.percentileTo >= 100 {
+			return
+		}
+		halvings := math.Floor(math.Log2(100 / (100 - it.percentileTo)))
+		ticks := float64(it.ticks) * math.Exp2(halvings+1)
+		it.percentileTo += 100 / ticks
+	}
+}
@@ -0,0 +1,149 @@
+package hdrhist
+
+import (
+	"math"
+	"testing"
+)
+
+func iterTestHist() *Hist {
+	h := WithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  3600 * 1000 * 1000,
+		SigFigs:           3,
+	})
+	for v := int64(1); v <= 10000; v++ {
+		h.Record(v)
+	}
+	return h
+}
+
+// checkSteps checks invariants shared by all iterators.
+func checkSteps(t *testing.T, name string, h *Hist, it HistIter) []HistIterVal {
+	var vals []HistIterVal
+	var prev HistIterVal
+	var added int64
+	for it.Next() {
+		v := it.Val()
+		if v.ValueFrom != prev.Value {
+			t.Errorf("%s: step %d: got ValueFrom %d, want %d", name, len(vals), v.ValueFrom, prev.Value)
+		}
+		// Percentile steps may stay within a bucket.
+		if len(vals) > 0 && (v.Value < prev.Value || v.Value == prev.Value && it.kind != iterPercentile) {
+			t.Errorf("%s: step %d: Value %d not above %d", name, len(vals), v.Value, prev.Value)
+		}
+		added += v.CountAdded
+		if v.CumCount != added {
+			t.Errorf("%s: step %d: got CumCount %d, want %d", name, len(vals), v.CumCount, added)
+		}
+		vals = append(vals, v)
+		prev = v
+	}
+	if added != h.TotalCount() {
+		t.Errorf("%s: counts added sum to %d, want %d", name, added, h.TotalCount())
+	}
+	return vals
+}
+
+func TestRecordedIter(t *testing.T) {
+	h := New(3)
+	h.RecordN(1, 2)
+	h.Record(5)
+	h.RecordN(100000, 3)
+	vals := checkSteps(t, "recorded", h, h.RecordedIter())
+	want := []struct{ v, count int64 }{
+		{1, 2},
+		{5, 1},
+		{h.b.highestEquiv(100000), 3},
+	}
+	if len(vals) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(vals), len(want))
+	}
+	for i, w := range want {
+		if vals[i].Value != w.v || vals[i].Count != w.count || vals[i].CountAdded != w.count {
+			t.Errorf("step %d: got %+v, want value %d count %d", i, vals[i], w.v, w.count)
+		}
+	}
+}
+
+func TestLinearIter(t *testing.T) {
+	h := iterTestHist()
+	vals := checkSteps(t, "linear", h, h.LinearIter(1000))
+	// 10000 is in the 11th step.
+	if len(vals) != 11 {
+		t.Fatalf("got %d steps, want 11", len(vals))
+	}
+	for i, v := range vals {
+		if want := int64(i+1)*1000 - 1; v.Value != want {
+			t.Errorf("step %d: got Value %d, want %d", i, v.Value, want)
+		}
+	}
+	// Values are bucketed with 3 significant digits,
+	// so steps only approximately hold 1000 values.
+	for i, v := range vals[:9] {
+		if v.CountAdded < 990 || v.CountAdded > 1010 {
+			t.Errorf("step %d: got CountAdded %d, want about 1000", i, v.CountAdded)
+		}
+	}
+	if last := vals[10]; last.CountAdded != 1 {
+		t.Errorf("got last CountAdded %d, want 1", last.CountAdded)
+	}
+}
+
+func TestLogIter(t *testing.T) {
+	h := iterTestHist()
+	vals := checkSteps(t, "log", h, h.LogIter(1000, 2))
+	want := []int64{999, 1999, 3999, 7999, 15999}
+	if len(vals) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(vals), len(want))
+	}
+	for i, w := range want {
+		if vals[i].Value != w {
+			t.Errorf("step %d: got Value %d, want %d", i, vals[i].Value, w)
+		}
+	}
+}
+
+func TestPercentileIter(t *testing.T) {
+	h := iterTestHist()
+	vals := checkSteps(t, "percentile", h, h.PercentileIter(5))
+	levels := []float64{0, 10, 20, 30, 40, 50, 55, 60, 65, 70, 75, 77.5, 80, 82.5, 85, 87.5, 88.75}
+	if len(vals) < len(levels) {
+		t.Fatalf("got %d steps, want more than %d", len(vals), len(levels))
+	}
+	for i, l := range levels {
+		if math.Abs(vals[i].PercentileLevel-l) > 1e-9 {
+			t.Errorf("step %d: got level %v, want %v", i, vals[i].PercentileLevel, l)
+		}
+	}
+	for i, v := range vals {
+		if v.Percentile < v.PercentileLevel {
+			t.Errorf("step %d: percentile %v below level %v", i, v.Percentile, v.PercentileLevel)
+		}
+	}
+	last := vals[len(vals)-1]
+	if last.PercentileLevel != 100 || last.Value != h.Max() {
+		t.Errorf("got last step %+v, want level 100 at %d", last, h.Max())
+	}
+}
+
+func TestIterEmpty(t *testing.T) {
+	h := New(3)
+	for _, it := range []HistIter{h.RecordedIter(), h.LinearIter(10), h.LogIter(10, 2), h.PercentileIter(5)} {
+		if it.Next() {
+			t.Errorf("got step %+v for empty hist", it.Val())
+		}
+	}
+}
+
+func TestIterAllocs(t *testing.T) {
+	h := iterTestHist()
+	allocs := testing.AllocsPerRun(10, func() {
+		for _, it := range []HistIter{h.RecordedIter(), h.LinearIter(100), h.LogIter(1, 2), h.PercentileIter(5)} {
+			for it.Next() {
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs, want 0", allocs)
+	}
+}
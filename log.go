@@ -3,9 +3,13 @@ package hdrhist
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/base64"
+	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -32,10 +36,12 @@ func splitLog(data []byte, atEOF bool) (advance int, token []byte, err error) {
 
 // LogReader reads hists from a log file.
 //
-// LogReader currently provides no mechanism for extracting comments, or start times.
+// Besides histograms, LogReader provides the start and base times,
+// legend, and comments found in the log.
 type LogReader struct {
 	s   *bufio.Scanner
 	err error
+	c   []io.Closer // closed by Close
 
 	startTime time.Time
 	baseTime  struct {
@@ -46,171 +52,616 @@ type LogReader struct {
 	foundStartTime bool
 	foundBaseTime  bool
 
-	cur *Hist
+	legend   []string
+	comments []string
+
+	// reused between histograms
+	lastTag string
+
+	line        int
+	lenient     bool
+	parseErrors []*LogParseError
+
+	dec decoder
+
+	filterTag bool
+	tag       string
+	doubles   bool
+
+	window struct {
+		relative   bool
+		start, end time.Time     // absolute window
+		startOff   time.Duration // relative window
+		endOff     time.Duration
+	}
+	pastEnd bool
+
+	cur       *Hist
+	curDouble *DoubleHist
 }
 
+// maxLogLineSize is the maximum length of a line in a log.
+// Uncompressed histograms can result in lines that exceed
+// the default limit of bufio.Scanner.
+const maxLogLineSize = 64 << 20
+
 func NewLogReader(r io.Reader) *LogReader {
 	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLogLineSize)
 	return &LogReader{
 		s: s,
 	}
 }
 
-func getFloat64Prefix(s string) (float64, error) {
-	s = strings.TrimSpace(s)
+// OpenLogReader opens the named log file for reading.
+// Files compressed with gzip, such as the ".hlog.gz" files
+// written by a RotatingLogWriter, are decompressed transparently.
+// The caller must call Close when done with the LogReader.
+func OpenLogReader(name string) (*LogReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open log")
+	}
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	c := []io.Closer{f}
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "unable to read compressed log")
+		}
+		r = zr
+		c = append(c, zr)
+	}
+	l := NewLogReader(r)
+	l.c = c
+	return l, nil
+}
+
+// Close closes the file opened by OpenLogReader.
+// It does nothing for LogReaders created by NewLogReader.
+func (l *LogReader) Close() error {
+	var err error
+	for i := len(l.c) - 1; i >= 0; i-- {
+		if cerr := l.c[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	l.c = nil
+	return err
+}
+
+// FilterTag restricts Scan to histograms with the given tag.
+// An empty tag selects histograms that have no tag.
+func (l *LogReader) FilterTag(tag string) {
+	l.filterTag = true
+	l.tag = tag
+}
+
+// SetWindow restricts Scan to histograms that start within [start, end).
+// A zero end leaves the window unbounded.
+// Histograms outside of the window are skipped without being decoded,
+// and Scan stops once it reads a histogram that starts at or after end.
+func (l *LogReader) SetWindow(start, end time.Time) {
+	l.window.relative = false
+	l.window.start = start
+	l.window.end = end
+}
+
+// SetRelativeWindow is like SetWindow but the window is given
+// as offsets from the start time of the log (see StartTime).
+// An end of 0 leaves the window unbounded.
+func (l *LogReader) SetRelativeWindow(start, end time.Duration) {
+	l.window.relative = true
+	l.window.startOff = start
+	l.window.endOff = end
+}
+
+// inWindow reports whether a histogram starting at t is in the window,
+// marking the end of the log as reached if t is past it.
+func (l *LogReader) inWindow(t time.Time) bool {
+	start, end := l.window.start, l.window.end
+	if l.window.relative {
+		start = l.startTime.Add(l.window.startOff)
+		end = time.Time{}
+		if l.window.endOff != 0 {
+			end = l.startTime.Add(l.window.endOff)
+		}
+	}
+	if !end.IsZero() && !t.Before(end) {
+		l.pastEnd = true
+		return false
+	}
+	return !t.Before(start)
+}
+
+// SetDoubleHists controls whether Scan returns double histograms,
+// such as those logged by HdrHistogram's DoubleHistogram.
+// By default they are skipped without being decoded,
+// so Hist is never nil once Scan returns true.
+// If enabled, Hist returns nil for double histograms
+// and DoubleHist returns them instead.
+// ScanInto always skips double histograms.
+func (l *LogReader) SetDoubleHists(enable bool) {
+	l.doubles = enable
+}
+
+// SetDecodeOptions sets the limits applied when decoding histograms.
+// Scan fails if a histogram exceeds them.
+func (l *LogReader) SetDecodeOptions(opts DecodeOptions) {
+	l.dec.opts = opts
+}
+
+// getSecondsPrefix parses the number of seconds at the start of b,
+// ignoring leading whitespace and any text following the number.
+func getSecondsPrefix(b []byte) (sec, nsec int64, err error) {
+	b = bytes.TrimSpace(b)
 	hasPeriod := false
-	end := len(s)
-	for i := 0; i < len(s); i++ {
-		if '0' <= s[i] && s[i] <= '9' {
+	end := len(b)
+	for i := 0; i < len(b); i++ {
+		if '0' <= b[i] && b[i] <= '9' || i == 0 && b[i] == '-' {
 			continue
 		}
-		if s[i] == '.' && !hasPeriod {
+		if b[i] == '.' && !hasPeriod {
 			hasPeriod = true
 			continue
 		}
 		end = i
 		break
 	}
-	return strconv.ParseFloat(s[:end], 64)
+	return parseSeconds(b[:end])
 }
 
-func (l *LogReader) Scan() bool {
-	if l.err != nil {
-		return false
+// parseSeconds parses a decimal number of seconds.
+// Plain decimals are parsed exactly, ignoring digits beyond nanoseconds,
+// while other formats accepted by strconv.ParseFloat are rounded.
+// sec and nsec have the same sign.
+func parseSeconds(b []byte) (sec, nsec int64, err error) {
+	digits := b
+	neg := len(digits) > 0 && digits[0] == '-'
+	if neg {
+		digits = digits[1:]
 	}
-	for l.s.Scan() {
-		s := l.s.Text()
-		switch {
-		case strings.HasPrefix(s, "#[StartTime:"):
-			t, err := getFloat64Prefix(strings.TrimPrefix(s, "#[StartTime:"))
-			if err != nil {
-				l.err = errors.Wrap(err, "unable to parse start time")
-				return false
-			}
-			sec, nano := math.Modf(t)
-			l.startTime = time.Unix(int64(sec), int64(nano*1e9))
-			l.foundStartTime = true
-			continue
-		case strings.HasPrefix(s, "#[BaseTime:"):
-			t, err := getFloat64Prefix(strings.TrimPrefix(s, "#[BaseTime:"))
-			if err != nil {
-				l.err = errors.Wrap(err, "unable to parse base time")
-				return false
-			}
-			sec, nano := math.Modf(t)
-			l.baseTime.sec = int64(sec)
-			l.baseTime.nano = int64(nano * 1e9)
-			l.foundBaseTime = true
-			continue
-		case strings.HasPrefix(s, "\"StartTimestamp\""), strings.HasPrefix(s, "#"):
-			// skip legend and comments
-			continue
+	intPart, frac := digits, []byte(nil)
+	if i := bytes.IndexByte(digits, '.'); i >= 0 {
+		intPart, frac = digits[:i], digits[i+1:]
+	}
+	exact := len(intPart)+len(frac) > 0 && len(intPart) <= 18
+	for _, c := range intPart {
+		exact = exact && '0' <= c && c <= '9'
+	}
+	for _, c := range frac {
+		exact = exact && '0' <= c && c <= '9'
+	}
+	if !exact {
+		f, err := strconv.ParseFloat(string(b), 64)
+		if err != nil {
+			return 0, 0, err
 		}
+		s, fr := math.Modf(f)
+		return int64(s), int64(fr * 1e9), nil
+	}
 
-		scanner := bufio.NewScanner(bytes.NewReader(l.s.Bytes()))
-		scanner.Split(splitLog)
-
-		if !scanner.Scan() {
-			if scanner.Err() != nil {
-				l.err = errors.Wrap(scanner.Err(), "no histogram data")
-				return false
-			} else {
-				continue
-			}
+	for _, c := range intPart {
+		sec = sec*10 + int64(c-'0')
+	}
+	for i := 0; i < 9; i++ {
+		nsec *= 10
+		if i < len(frac) {
+			nsec += int64(frac[i] - '0')
 		}
+	}
+	if neg {
+		sec, nsec = -sec, -nsec
+	}
+	return sec, nsec, nil
+}
+
+var (
+	startTimePrefix = []byte("#[StartTime:")
+	baseTimePrefix  = []byte("#[BaseTime:")
+	legendPrefix    = []byte("\"StartTimestamp\"")
+	tagPrefix       = []byte("Tag=")
+)
+
+// A LogParseError describes a malformed line in a log.
+type LogParseError struct {
+	Line   int    // line number, starting at 1
+	Column int    // byte offset of Token in the line, starting at 1
+	Token  string // offending field, truncated if long
+	Msg    string
+	Err    error // underlying error, may be nil
+}
+
+// maxErrTokenLen is the length to which LogParseError tokens are truncated.
+const maxErrTokenLen = 64
+
+func (e *LogParseError) Error() string {
+	msg := fmt.Sprintf("hdrhist: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	if e.Token != "" {
+		msg += fmt.Sprintf(" at %q", e.Token)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *LogParseError) Unwrap() error { return e.Err }
+
+// SetLenient controls whether Scan stops at malformed lines.
+// In lenient mode, malformed lines are skipped
+// and their errors are available from ParseErrors.
+// Errors reading the underlying reader always stop Scan.
+func (l *LogReader) SetLenient(lenient bool) {
+	l.lenient = lenient
+}
+
+// ParseErrors returns the errors of the lines skipped in lenient mode.
+func (l *LogReader) ParseErrors() []*LogParseError {
+	return l.parseErrors
+}
+
+// lineErr returns an error for the field of the current line
+// starting at byte offset off.
+func (l *LogReader) lineErr(line []byte, off int, msg string, err error) *LogParseError {
+	return newLogParseError(l.line, line, off, msg, err)
+}
+
+func newLogParseError(lineNum int, line []byte, off int, msg string, err error) *LogParseError {
+	tok, _ := nextField(line[off:])
+	if len(tok) > maxErrTokenLen {
+		tok = tok[:maxErrTokenLen]
+	}
+	return &LogParseError{
+		Line:   lineNum,
+		Column: off + 1,
+		Token:  string(tok),
+		Msg:    msg,
+		Err:    err,
+	}
+}
+
+// report records e and reports whether scanning must stop.
+func (l *LogReader) report(e *LogParseError) bool {
+	if l.lenient {
+		l.parseErrors = append(l.parseErrors, e)
+		return false
+	}
+	l.err = e
+	return true
+}
+
+// fieldOff returns the offset of field within line.
+func fieldOff(line, field []byte) int {
+	return cap(line) - cap(field)
+}
+
+// nextField splits the next field of a histogram line from b.
+func nextField(b []byte) (field, rest []byte) {
+	advance, field, _ := splitLog(b, true)
+	return field, b[advance:]
+}
 
-		s = scanner.Text()
+// Scan reads the next histogram from the log,
+// which is then available from Hist,
+// or from DoubleHist if enabled by SetDoubleHists.
+// It returns false when the log ends or an error occurs.
+func (l *LogReader) Scan() bool {
+	return l.scan(nil)
+}
+
+// ScanInto is like Scan but decodes integer histograms into h,
+// reusing its memory, rather than allocating a new Hist.
+// Along with buffers kept by l, this lets a log be read
+// without allocating once the buffers have grown to fit its histograms.
+// Double histograms are skipped.
+//
+// If ScanInto returns true, h holds the scanned histogram
+// and Hist returns h.
+// If decoding fails, the contents of h are unspecified.
+func (l *LogReader) ScanInto(h *Hist) bool {
+	return l.scan(h)
+}
 
-		// decode Tag=[junk],
-		if strings.HasPrefix(s, "Tag=") {
-			// skip histogram tags, we don't support them
-			if !scanner.Scan() {
-				l.err = errors.New("malformed input, expected start timestamp")
-				return false
+// internTag returns b as a string,
+// avoiding an allocation if b matches the previous tag.
+func (l *LogReader) internTag(b []byte) string {
+	if string(b) != l.lastTag {
+		l.lastTag = string(b)
+	}
+	return l.lastTag
+}
+
+func (l *LogReader) scan(h *Hist) bool {
+	if l.err != nil || l.pastEnd {
+		return false
+	}
+	l.comments = nil
+	var e logEntry
+	for l.s.Scan() {
+		ok, perr := l.parseLine(l.s.Bytes(), &e)
+		if ok && e.double && h != nil {
+			ok = false
+			l.skipped()
+		}
+		if ok {
+			var hist *Hist
+			var dhist *DoubleHist
+			hist, dhist, perr = l.dec.decodeEntry(&e, h)
+			if perr == nil {
+				l.cur = hist
+				l.curDouble = dhist
+				return true
 			}
-			s = scanner.Text()
+			l.skipped()
 		}
-
-		// decode startTimestamp,intervalLength,maxval,histPayload
-		t, err := strconv.ParseFloat(s, 64)
-		if err != nil {
-			l.err = errors.Wrap(err, "invalid timestamp")
+		if perr != nil && l.report(perr) {
 			return false
 		}
-
-		sec, nano := math.Modf(t)
-		tstamp := time.Unix(int64(sec), int64(nano*1e9))
-		if !l.foundStartTime {
-			l.startTime = tstamp
-			l.foundStartTime = true
+		if l.pastEnd {
+			return false
 		}
+	}
+	if err := l.s.Err(); err != nil {
+		l.err = errors.Wrap(err, "unable to read log")
+	}
+	return false
+}
 
-		if !l.foundBaseTime {
-			if l.startTime.Sub(tstamp) > 365*24*time.Hour {
-				// NOTE: assume that timestamps in the log are not absolute
-				// if the log timestamp is > 1 year ago
-				l.baseTime.sec = l.startTime.Unix()
-				l.baseTime.nano = int64(l.startTime.Nanosecond())
-			} else {
-				l.baseTime.sec = 0
-				l.baseTime.nano = 0
-			}
-			l.foundBaseTime = true
-		}
-		// need to create tstamp twice because duration might overflow
-		tstamp = time.Unix(tstamp.Unix()+l.baseTime.sec, int64(tstamp.Nanosecond())+l.baseTime.nano)
+// A logEntry is a histogram line whose payload has yet to be decoded.
+type logEntry struct {
+	line       int    // line number
+	text       []byte // the line
+	tag        string
+	start, end time.Time
+	payload    []byte // base64 encoded histogram within text
+	double     bool   // payload is a double histogram
+}
 
-		if !scanner.Scan() {
-			l.err = errors.New("malformed input, expected interval length")
-			return false
+// parseLine parses the next line of the log.
+// Headers and comments are recorded in l.
+// If the line is a histogram that passes the tag filter and time window,
+// and is not a double histogram unless enabled by SetDoubleHists,
+// parseLine fills in e, which refers to line, and returns true.
+func (l *LogReader) parseLine(line []byte, e *logEntry) (ok bool, perr *LogParseError) {
+	l.line++
+	switch {
+	case bytes.HasPrefix(line, startTimePrefix):
+		sec, nsec, err := getSecondsPrefix(line[len(startTimePrefix):])
+		if err != nil {
+			return false, l.lineErr(line, len(startTimePrefix), "unable to parse start time", err)
 		}
-		s = scanner.Text()
-		t, err = strconv.ParseFloat(s, 64)
+		l.startTime = time.Unix(sec, nsec)
+		l.foundStartTime = true
+		return false, nil
+	case bytes.HasPrefix(line, baseTimePrefix):
+		sec, nsec, err := getSecondsPrefix(line[len(baseTimePrefix):])
 		if err != nil {
-			l.err = errors.Wrap(err, "invalid interval length")
-			return false
+			return false, l.lineErr(line, len(baseTimePrefix), "unable to parse base time", err)
 		}
-		sec, nano = math.Modf(t)
-		tstampEnd := tstamp.Add(time.Duration(sec)*time.Second + time.Duration(nano*1e9)*time.Nanosecond)
+		l.baseTime.sec = sec
+		l.baseTime.nano = nsec
+		l.foundBaseTime = true
+		return false, nil
+	case bytes.HasPrefix(line, legendPrefix):
+		l.legend = parseLegend(string(line))
+		return false, nil
+	case len(line) > 0 && line[0] == '#':
+		l.comments = append(l.comments, string(line[1:]))
+		return false, nil
+	case len(line) == 0:
+		return false, nil
+	}
 
-		if !scanner.Scan() {
-			l.err = errors.New("malformed input, expected max hist value")
-			return false
+	ok, perr = l.parseHistLine(line, e)
+	if !ok {
+		l.skipped()
+	}
+	return ok, perr
+}
+
+// skipped drops the comments preceding a histogram that is not returned,
+// since comments belong to the interval that follows them.
+func (l *LogReader) skipped() {
+	l.comments = nil
+}
+
+// parseHistLine is like parseLine for a histogram line.
+func (l *LogReader) parseHistLine(line []byte, e *logEntry) (ok bool, perr *LogParseError) {
+	f, rest := nextField(line)
+
+	// decode Tag=[tag],
+	var tag string
+	if bytes.HasPrefix(f, tagPrefix) {
+		tag = l.internTag(f[len(tagPrefix):])
+		if len(rest) == 0 {
+			return false, l.lineErr(line, len(line), "expected start timestamp", nil)
 		}
-		// skip max hist value, already is in the histogram
+		f, rest = nextField(rest)
+	}
 
-		if !scanner.Scan() {
-			l.err = errors.New("malformed input, expect encoded histogram")
-			return false
+	// decode startTimestamp,intervalLength,maxval,histPayload
+	sec, nsec, err := parseSeconds(f)
+	if err != nil {
+		return false, l.lineErr(line, fieldOff(line, f), "invalid timestamp", err)
+	}
+	tstamp := time.Unix(sec, nsec)
+	if !l.foundStartTime {
+		l.startTime = tstamp
+		l.foundStartTime = true
+	}
+
+	if !l.foundBaseTime {
+		if l.startTime.Sub(tstamp) > 365*24*time.Hour {
+			// NOTE: assume that timestamps in the log are not absolute
+			// if the log timestamp is > 1 year ago
+			l.baseTime.sec = l.startTime.Unix()
+			l.baseTime.nano = int64(l.startTime.Nanosecond())
+		} else {
+			l.baseTime.sec = 0
+			l.baseTime.nano = 0
 		}
+		l.foundBaseTime = true
+	}
+	// need to create tstamp twice because duration might overflow
+	tstamp = time.Unix(tstamp.Unix()+l.baseTime.sec, int64(tstamp.Nanosecond())+l.baseTime.nano)
 
-		n := base64.StdEncoding.DecodedLen(len(scanner.Bytes()))
-		buf := make([]byte, n)
-		_, err = base64.StdEncoding.Decode(buf, scanner.Bytes())
-		if err != nil {
-			l.err = errors.Wrap(err, "malformed base64 histogram")
-			return false
+	if !l.inWindow(tstamp) {
+		return false, nil
+	}
+
+	if len(rest) == 0 {
+		return false, l.lineErr(line, len(line), "expected interval length", nil)
+	}
+	f, rest = nextField(rest)
+	sec, nsec, err = parseSeconds(f)
+	if err != nil {
+		return false, l.lineErr(line, fieldOff(line, f), "invalid interval length", err)
+	}
+	tstampEnd := tstamp.Add(time.Duration(sec)*time.Second + time.Duration(nsec))
+
+	if len(rest) == 0 {
+		return false, l.lineErr(line, len(line), "expected max hist value", nil)
+	}
+	// skip max hist value, already is in the histogram
+	_, rest = nextField(rest)
+
+	if len(rest) == 0 {
+		return false, l.lineErr(line, len(line), "expected encoded histogram", nil)
+	}
+	f, _ = nextField(rest)
+
+	if l.filterTag && tag != l.tag {
+		return false, nil
+	}
+	double := isDoublePayload(f)
+	if double && !l.doubles {
+		return false, nil
+	}
+
+	*e = logEntry{
+		line:    l.line,
+		text:    line,
+		tag:     tag,
+		start:   tstamp,
+		end:     tstampEnd,
+		payload: f,
+		double:  double,
+	}
+	return true, nil
+}
+
+// isDoublePayload reports whether the base64 encoded histogram
+// in payload is a double histogram, decoding only its cookie.
+func isDoublePayload(payload []byte) bool {
+	if len(payload) < 8 {
+		return false
+	}
+	var b [6]byte
+	n, err := base64.StdEncoding.Decode(b[:], payload[:8])
+	return err == nil && n >= 4 && isDoubleHistCookie(int32(binary.BigEndian.Uint32(b[:])))
+}
+
+// decodeEntry decodes the histogram of e into h, allocating h if nil.
+// Double histograms are decoded into a new DoubleHist instead.
+func (d *decoder) decodeEntry(e *logEntry, h *Hist) (*Hist, *DoubleHist, *LogParseError) {
+	off := fieldOff(e.text, e.payload)
+	n := base64.StdEncoding.DecodedLen(len(e.payload))
+	if cap(d.b64) < n {
+		d.b64 = make([]byte, n)
+	}
+	n, err := base64.StdEncoding.Decode(d.b64[:n], e.payload)
+	if err != nil {
+		return nil, nil, newLogParseError(e.line, e.text, off, "malformed base64 histogram", err)
+	}
+	buf := d.b64[:n]
+	if len(buf) >= 4 && isDoubleHistCookie(int32(binary.BigEndian.Uint32(buf))) {
+		var dhist DoubleHist
+		if err := d.decodeDouble(&dhist, buf); err != nil {
+			return nil, nil, newLogParseError(e.line, e.text, off, "unable to decode double histogram", err)
 		}
-		var hist Hist
-		err = decodeCompressed(&hist, buf)
-		if err != nil {
-			l.err = errors.Wrap(err, "unable to decode histogram")
-			return false
+		dhist.SetStartTime(e.start)
+		dhist.SetEndTime(e.end)
+		dhist.SetTag(e.tag)
+		return nil, &dhist, nil
+	}
+
+	if h == nil {
+		h = new(Hist)
+	}
+	if _, err := d.decodeBuf(h, buf); err != nil {
+		return nil, nil, newLogParseError(e.line, e.text, off, "unable to decode histogram", err)
+	}
+	h.SetStartTime(e.start)
+	h.SetEndTime(e.end)
+	h.SetTag(e.tag)
+	return h, nil, nil
+}
+
+// parseLegend splits a legend line into its column names.
+func parseLegend(s string) []string {
+	cols := strings.Split(s, ",")
+	for i, c := range cols {
+		if u, err := strconv.Unquote(strings.TrimSpace(c)); err == nil {
+			cols[i] = u
 		}
+	}
+	return cols
+}
 
-		hist.SetStartTime(tstamp)
-		hist.SetEndTime(tstampEnd)
+// StartTime returns the start time of the log.
+// It is taken from the StartTime header if present,
+// or else from the first histogram.
+// ok is false if neither has been read yet.
+func (l *LogReader) StartTime() (t time.Time, ok bool) {
+	return l.startTime, l.foundStartTime
+}
 
-		l.cur = &hist
-		return true
+// BaseTime returns the time that histogram timestamps are relative to.
+// It is taken from the BaseTime header if present,
+// or else inferred from the first histogram.
+// ok is false if neither has been read yet.
+func (l *LogReader) BaseTime() (t time.Time, ok bool) {
+	if !l.foundBaseTime {
+		return time.Time{}, false
 	}
-	return false
+	return time.Unix(l.baseTime.sec, l.baseTime.nano), true
+}
+
+// Legend returns the column names of the most recently read legend line,
+// or nil if the log has no legend.
+func (l *LogReader) Legend() []string {
+	return l.legend
+}
+
+// Comments returns the comment lines, without the leading '#',
+// that were read before the most recently scanned histogram
+// and after the one preceding it.
+// Comments preceding histograms that are skipped, because of FilterTag,
+// the window, or a lenient parse error, are dropped along with them.
+// Once Scan returns false, Comments returns the comments
+// that follow the last histogram.
+// The StartTime and BaseTime headers are not included.
+func (l *LogReader) Comments() []string {
+	return l.comments
 }
 
+// Hist returns the most recently scanned histogram.
+// It returns nil if the histogram is a double histogram
+// returned because of SetDoubleHists,
+// in which case it is available from DoubleHist.
 func (l *LogReader) Hist() *Hist {
 	return l.cur
 }
 
+// DoubleHist returns the most recently scanned histogram
+// if it is a double histogram, and nil otherwise.
+func (l *LogReader) DoubleHist() *DoubleHist {
+	return l.curDouble
+}
+
 func (l *LogReader) Err() error {
 	return l.err
 }
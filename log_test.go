@@ -106,10 +106,27 @@ func TestLogReaderMetadata(t *testing.T) {
 		return
 	}
 	h := r.Hist()
+	wantComments := []string{"this should be ignored", "[Histogram log format version 1.3]"}
+	if c := r.Comments(); fmt.Sprintf("%q", c) != fmt.Sprintf("%q", wantComments) {
+		t.Errorf("comments: want %q got %q", wantComments, c)
+	}
+	wantLegend := []string{"StartTimestamp", "Interval_Length", "Interval_Max", "Interval_Compressed_Histogram"}
+	if l := r.Legend(); fmt.Sprintf("%q", l) != fmt.Sprintf("%q", wantLegend) {
+		t.Errorf("legend: want %q got %q", wantLegend, l)
+	}
+	if st, ok := r.StartTime(); !ok || !fuzzyEqual(st, unixMillisToTime(123)) {
+		t.Errorf("log start time: want %v got %v", unixMillisToTime(123), st)
+	}
+	if bt, ok := r.BaseTime(); !ok || !fuzzyEqual(bt, unixMillisToTime(14124)) {
+		t.Errorf("log base time: want %v got %v", unixMillisToTime(14124), bt)
+	}
 	if r.Scan() {
 		t.Errorf("did not want second hist, got: %v", r.Hist())
 		return
 	}
+	if c := r.Comments(); len(c) != 0 {
+		t.Errorf("want no trailing comments, got %q", c)
+	}
 	if err := r.Err(); err != nil {
 		t.Errorf("unexpected error: %v", err)
 		return
@@ -330,3 +347,477 @@ func sameContents(b1, b2 []byte) error {
 	}
 	return nil
 }
+
+func TestLogTags(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	start := time.Unix(1000, 0)
+	var want []*Hist
+	for i, tag := range []string{"A", "", "B", "A"} {
+		h := New(2)
+		h.RecordN(int64(i+1), int64(i+1))
+		h.SetStartTime(start.Add(time.Duration(i) * time.Second))
+		h.SetEndTime(start.Add(time.Duration(i+1) * time.Second))
+		h.SetTag(tag)
+		if err := w.WriteIntervalHist(h); err != nil {
+			t.Fatalf("unable to write hist %d: %v", i, err)
+		}
+		want = append(want, h)
+	}
+	bad := New(2)
+	bad.SetTag("a,b")
+	if err := w.WriteIntervalHist(bad); err == nil {
+		t.Error("want error writing tag containing a comma")
+	}
+	if !strings.HasPrefix(buf.String(), "Tag=A,") {
+		t.Errorf("want log to start with Tag=A, got %q", strings.SplitN(buf.String(), "\n", 2)[0])
+	}
+
+	tests := []struct {
+		filter bool
+		tag    string
+		want   []int
+	}{
+		{false, "", []int{0, 1, 2, 3}},
+		{true, "A", []int{0, 3}},
+		{true, "B", []int{2}},
+		{true, "", []int{1}},
+		{true, "C", nil},
+	}
+	for _, test := range tests {
+		r := NewLogReader(bytes.NewReader(buf.Bytes()))
+		if test.filter {
+			r.FilterTag(test.tag)
+		}
+		var got []int
+		for r.Scan() {
+			h := r.Hist()
+			i := int(h.TotalCount()) - 1
+			if h.Tag() != want[i].Tag() {
+				t.Errorf("hist %d: want tag %q got %q", i, want[i].Tag(), h.Tag())
+			}
+			got = append(got, i)
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("filter %q: unable to read: %v", test.tag, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("filter (%t, %q): want hists %v got %v", test.filter, test.tag, test.want, got)
+		}
+	}
+}
+
+func TestLogReaderComments(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	w.WriteComment("run: a")
+	w.WriteComment("jvm: 1.8")
+	for i := 0; i < 2; i++ {
+		h := New(2)
+		h.Record(1)
+		if err := w.WriteIntervalHist(h); err != nil {
+			t.Fatalf("unable to write hist: %v", err)
+		}
+	}
+	w.WriteComment("done")
+
+	r := NewLogReader(&buf)
+	for i, want := range [][]string{{"run: a", "jvm: 1.8"}, nil} {
+		if !r.Scan() {
+			t.Fatalf("hist %d: want hist, got error: %v", i, r.Err())
+		}
+		if c := r.Comments(); fmt.Sprintf("%q", c) != fmt.Sprintf("%q", want) {
+			t.Errorf("hist %d: want comments %q got %q", i, want, c)
+		}
+	}
+	if r.Scan() {
+		t.Fatal("want no more hists")
+	}
+	if c := r.Comments(); len(c) != 1 || c[0] != "done" {
+		t.Errorf("want trailing comment done, got %q", c)
+	}
+}
+
+func TestLogReaderCommentsSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	for _, c := range []struct{ comment, tag string }{
+		{"a", "x"},
+		{"b", "y"},
+		{"c", "x"},
+		{"d", ""},
+		{"e", "x"},
+	} {
+		w.WriteComment(c.comment)
+		if c.tag == "" {
+			buf.WriteString("Tag=x,not a histogram\n")
+			continue
+		}
+		h := New(2)
+		h.Record(1)
+		h.SetTag(c.tag)
+		if err := w.WriteIntervalHist(h); err != nil {
+			t.Fatalf("unable to write hist: %v", err)
+		}
+	}
+
+	r := NewLogReader(&buf)
+	r.FilterTag("x")
+	r.SetLenient(true)
+	for i, want := range [][]string{{"a"}, {"c"}, {"e"}} {
+		if !r.Scan() {
+			t.Fatalf("hist %d: want hist, got error: %v", i, r.Err())
+		}
+		if c := r.Comments(); fmt.Sprintf("%q", c) != fmt.Sprintf("%q", want) {
+			t.Errorf("hist %d: want comments %q got %q", i, want, c)
+		}
+	}
+	if r.Scan() {
+		t.Fatal("want no more hists")
+	}
+	if len(r.ParseErrors()) != 1 {
+		t.Errorf("want 1 parse error, got %v", r.ParseErrors())
+	}
+}
+
+func TestLogReaderWindow(t *testing.T) {
+	start := time.Unix(5000, 0)
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	w.WriteStartTime(start)
+	for i := 0; i < 10; i++ {
+		if i == 1 {
+			// corrupt histograms outside of the window are not decoded
+			fmt.Fprintf(&buf, "%d.000,1.000,0.001,HISTnotbase64\n", 5001)
+			continue
+		}
+		h := New(2)
+		h.RecordN(1, int64(i+1))
+		h.SetStartTime(start.Add(time.Duration(i) * time.Second))
+		h.SetEndTime(start.Add(time.Duration(i+1) * time.Second))
+		if err := w.WriteIntervalHist(h); err != nil {
+			t.Fatalf("unable to write hist %d: %v", i, err)
+		}
+	}
+	fmt.Fprintf(&buf, "%d.000,1.000,0.001,HISTnotbase64\n", 5010)
+
+	tests := []struct {
+		name    string
+		set     func(r *LogReader)
+		want    []int64
+		wantErr bool
+	}{
+		{"absolute", func(r *LogReader) { r.SetWindow(start.Add(2*time.Second), start.Add(5*time.Second)) }, []int64{3, 4, 5}, false},
+		{"relative", func(r *LogReader) { r.SetRelativeWindow(7*time.Second, 9*time.Second) }, []int64{8, 9}, false},
+		{"open end", func(r *LogReader) { r.SetRelativeWindow(8*time.Second, 0) }, []int64{9, 10}, true},
+	}
+	for _, test := range tests {
+		r := NewLogReader(bytes.NewReader(buf.Bytes()))
+		test.set(r)
+		var got []int64
+		for r.Scan() {
+			got = append(got, r.Hist().TotalCount())
+		}
+		if gotErr := r.Err() != nil; gotErr != test.wantErr {
+			t.Errorf("%s: want error %t, got %v", test.name, test.wantErr, r.Err())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: want hists %v got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func scanIntoTestLog(t testing.TB, n int) []byte {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	start := time.Unix(1000, 0)
+	for i := 0; i < n; i++ {
+		h := New(3)
+		for v := int64(1); v < 100000; v *= 3 {
+			h.RecordN(v+int64(i), int64(i+1))
+		}
+		h.SetStartTime(start.Add(time.Duration(i) * time.Second))
+		h.SetEndTime(start.Add(time.Duration(i+1) * time.Second))
+		h.SetTag("t")
+		if err := w.WriteIntervalHist(h); err != nil {
+			t.Fatalf("unable to write hist %d: %v", i, err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestLogReaderScanInto(t *testing.T) {
+	data := scanIntoTestLog(t, 20)
+	want := NewLogReader(bytes.NewReader(data))
+	got := NewLogReader(bytes.NewReader(data))
+	h := New(1)
+	for want.Scan() {
+		if !got.ScanInto(h) {
+			t.Fatalf("ScanInto failed: %v", got.Err())
+		}
+		if got.Hist() != h {
+			t.Error("Hist() does not return h")
+		}
+		if err := sameHistsNoTime(want.Hist(), h); err != nil {
+			t.Error(err)
+		}
+		if h.Tag() != want.Hist().Tag() {
+			t.Errorf("tag: want %q got %q", want.Hist().Tag(), h.Tag())
+		}
+	}
+	if got.ScanInto(h) {
+		t.Error("want ScanInto to return false at end of log")
+	}
+
+	// once buffers are warm, reading a histogram does not allocate
+	data = scanIntoTestLog(t, 200)
+	r := NewLogReader(bytes.NewReader(data))
+	r.ScanInto(h) // warm up buffers
+	allocs := testing.AllocsPerRun(100, func() {
+		if !r.ScanInto(h) {
+			t.Fatalf("ScanInto failed: %v", r.Err())
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("want no allocations per hist, got %v", allocs)
+	}
+}
+
+func BenchmarkLogReaderScanInto(b *testing.B) {
+	data := scanIntoTestLog(b, 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var h Hist
+	for i := 0; i < b.N; {
+		r := NewLogReader(bytes.NewReader(data))
+		for ; i < b.N && r.ScanInto(&h); i++ {
+		}
+		if r.Err() != nil {
+			b.Fatal(r.Err())
+		}
+	}
+}
+
+func TestLogReaderParseErrors(t *testing.T) {
+	h := New(2)
+	h.Record(1)
+	var good bytes.Buffer
+	if err := NewLogWriter(&good).WriteIntervalHist(h); err != nil {
+		t.Fatalf("unable to write hist: %v", err)
+	}
+	line := good.String()
+
+	log := "#comment\n" +
+		line +
+		"1.000,x.5,0.001,HIST\n" +
+		line +
+		"2.000,1.000\n" +
+		line +
+		line[:len(line)/2] // truncated by a crash
+
+	r := NewLogReader(strings.NewReader(log))
+	if !r.Scan() {
+		t.Fatalf("want first hist, got error: %v", r.Err())
+	}
+	if r.Scan() {
+		t.Fatal("want error on line 3")
+	}
+	pe, ok := r.Err().(*LogParseError)
+	if !ok {
+		t.Fatalf("want *LogParseError, got %v", r.Err())
+	}
+	if pe.Line != 3 || pe.Column != 7 || pe.Token != "x.5" {
+		t.Errorf("want error at line 3, column 7, token x.5; got %+v", pe)
+	}
+
+	r = NewLogReader(strings.NewReader(log))
+	r.SetLenient(true)
+	n := 0
+	for r.Scan() {
+		n++
+	}
+	if err := r.Err(); err != nil {
+		t.Errorf("unexpected error in lenient mode: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("want 3 hists, got %d", n)
+	}
+	want := []struct{ line, col int }{{3, 7}, {5, 12}, {7, 1 + strings.LastIndex(line[:len(line)/2], ",") + 1}}
+	errs := r.ParseErrors()
+	if len(errs) != len(want) {
+		t.Fatalf("want %d parse errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Line != w.line || errs[i].Column != w.col {
+			t.Errorf("error %d: want line %d column %d, got %v", i, w.line, w.col, errs[i])
+		}
+	}
+}
+
+func TestLogWriterWithConfig(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	var buf bytes.Buffer
+	w := NewLogWriterWithConfig(&buf, LogWriterConfig{
+		StartTime: start,
+		BaseTime:  start,
+		Comments:  []string{"run: test"},
+		Tag:       "default",
+		Precision: time.Microsecond,
+	})
+	for i, tag := range []string{"", "other"} {
+		h := New(2)
+		h.Record(int64(i + 1))
+		h.SetStartTime(start.Add(time.Duration(i)*time.Second + 1500*time.Microsecond))
+		h.SetEndTime(start.Add(time.Duration(i+1) * time.Second))
+		h.SetTag(tag)
+		if err := w.Write(h); err != nil {
+			t.Fatalf("unable to write hist %d: %v", i, err)
+		}
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	wantPrefixes := []string{
+		"#run: test",
+		"#[Histogram log format version 1.3]",
+		"#[StartTime: ",
+		"#[BaseTime: ",
+		"\"StartTimestamp\"",
+		"Tag=default,0.001500,0.998500,",
+		"Tag=other,1.001500,0.998500,",
+	}
+	for i, want := range wantPrefixes {
+		if i >= len(lines) || !strings.HasPrefix(lines[i], want) {
+			t.Fatalf("line %d: want prefix %q, log:\n%s", i, want, buf.String())
+		}
+	}
+
+	r := NewLogReader(&buf)
+	for i, tag := range []string{"default", "other"} {
+		if !r.Scan() {
+			t.Fatalf("hist %d: want hist, got error: %v", i, r.Err())
+		}
+		h := r.Hist()
+		if h.Tag() != tag {
+			t.Errorf("hist %d: want tag %q got %q", i, tag, h.Tag())
+		}
+		want := start.Add(time.Duration(i)*time.Second + 1500*time.Microsecond)
+		if st, _ := h.StartTime(); st.Sub(want) > time.Microsecond || want.Sub(st) > time.Microsecond {
+			t.Errorf("hist %d: want start time %v got %v", i, want, st)
+		}
+	}
+}
+
+func TestLogWriterPrecision(t *testing.T) {
+	tests := []struct {
+		p    time.Duration
+		want string
+	}{
+		{time.Second, "12,"},
+		{0, "12.345,"},
+		{time.Millisecond, "12.345,"},
+		{10 * time.Microsecond, "12.34567,"},
+		{time.Nanosecond, "12.345678912,"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewLogWriterWithConfig(&buf, LogWriterConfig{OmitLegend: true, Precision: test.p})
+		h := New(1)
+		h.SetStartTime(time.Unix(12, 345678912))
+		h.SetEndTime(time.Unix(13, 0))
+		if err := w.Write(h); err != nil {
+			t.Fatalf("unable to write: %v", err)
+		}
+		line := strings.Split(buf.String(), "\n")[1]
+		if !strings.HasPrefix(line, test.want) {
+			t.Errorf("precision %v: want prefix %q got %q", test.p, test.want, line)
+		}
+	}
+	if !doesPanic(func() { NewLogWriterWithConfig(ioutil.Discard, LogWriterConfig{Precision: 3 * time.Millisecond}) }) {
+		t.Error("want panic for invalid precision")
+	}
+}
+
+func TestLogStartBaseTimeHeaders(t *testing.T) {
+	ts := time.Unix(1500000000, 123456789)
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	w.WriteStartTime(ts)
+	w.WriteBaseTime(ts)
+	lines := strings.Split(buf.String(), "\n")
+	if want := "#[StartTime: 1500000000.123 (seconds since epoch), "; !strings.HasPrefix(lines[0], want) {
+		t.Errorf("start time: want prefix %q got %q", want, lines[0])
+	}
+	if want := "#[BaseTime: 1500000000.123 (seconds since epoch)]"; lines[1] != want {
+		t.Errorf("base time: want %q got %q", want, lines[1])
+	}
+}
+
+func TestLogTimestampRoundTrip(t *testing.T) {
+	start := time.Unix(1500000000, 123456789)
+	for _, base := range []bool{false, true} {
+		cfg := LogWriterConfig{StartTime: start, Precision: time.Nanosecond}
+		if base {
+			cfg.BaseTime = start.Add(-time.Second)
+		}
+		var buf bytes.Buffer
+		w := NewLogWriterWithConfig(&buf, cfg)
+		var want []*Hist
+		for i := 0; i < 3; i++ {
+			h := New(1)
+			h.Record(1)
+			h.SetStartTime(start.Add(time.Duration(i) * 2500 * time.Microsecond))
+			h.SetEndTime(start.Add(time.Duration(i+1)*2500*time.Microsecond - 7))
+			if err := w.Write(h); err != nil {
+				t.Fatalf("unable to write: %v", err)
+			}
+			want = append(want, h)
+		}
+
+		r := NewLogReader(&buf)
+		for i, h := range want {
+			if !r.Scan() {
+				t.Fatalf("base %t: hist %d: want hist, got error: %v", base, i, r.Err())
+			}
+			ws, _ := h.StartTime()
+			we, _ := h.EndTime()
+			gs, _ := r.Hist().StartTime()
+			ge, _ := r.Hist().EndTime()
+			if !gs.Equal(ws) || !ge.Equal(we) {
+				t.Errorf("base %t: hist %d: want [%v, %v] got [%v, %v]", base, i, ws, we, gs, ge)
+			}
+		}
+		if st, _ := r.StartTime(); !st.Equal(start) {
+			t.Errorf("base %t: log start time: want %v got %v", base, start, st)
+		}
+		if bt, _ := r.BaseTime(); base && !bt.Equal(cfg.BaseTime) {
+			t.Errorf("log base time: want %v got %v", cfg.BaseTime, bt)
+		}
+	}
+}
+
+func TestParseSeconds(t *testing.T) {
+	tests := []struct {
+		s         string
+		sec, nsec int64
+	}{
+		{"0", 0, 0},
+		{"1.5", 1, 500000000},
+		{"1500000000.123456789", 1500000000, 123456789},
+		{"12.3456789129", 12, 345678912},
+		{".25", 0, 250000000},
+		{"-0.5", 0, -500000000},
+		{"-2.001", -2, -1000000},
+		{"1e3", 1000, 0},
+	}
+	for _, test := range tests {
+		sec, nsec, err := parseSeconds([]byte(test.s))
+		if err != nil || sec != test.sec || nsec != test.nsec {
+			t.Errorf("%q: want (%d, %d) got (%d, %d, %v)", test.s, test.sec, test.nsec, sec, nsec, err)
+		}
+	}
+	for _, s := range []string{"", "-", ".", "1.2.3", "abc"} {
+		if _, _, err := parseSeconds([]byte(s)); err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
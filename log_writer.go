@@ -5,6 +5,9 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -19,39 +22,165 @@ import (
 //
 // Typical usage of a LogWriter would be as follows:
 //     now := time.Now()
-//     lw := NewLogWriter(w)
-//     lw.WriteStartTime(now)
-//     lw.SetBaseTime(now)
-//     lw.WriteLegend()
+//     lw := NewLogWriterWithConfig(w, LogWriterConfig{
+//         StartTime: now,
+//         BaseTime:  now,
+//     })
+//     for h := range intervals {
+//         lw.Write(h)
+//     }
 //
-// LogWriter is unfortunately difficult to use and was taken
-// almost directly from the Java pacakge.
-// This API should be revisited.
+// The header is written along with the first histogram.
+// The remaining methods write individual parts of a log
+// and mirror the API of the Java package.
 type LogWriter struct {
 	w        io.Writer
 	buf      bytes.Buffer
 	baseTime *time.Time
+
+	cfg           LogWriterConfig
+	digits        int // digits after the decimal point of timestamps
+	headerPending bool
+}
+
+// LogWriterConfig configures the header and formatting
+// of a log written by a LogWriter.
+type LogWriterConfig struct {
+	// StartTime is written to the header if non-zero.
+	StartTime time.Time
+
+	// BaseTime is written to the header if non-zero,
+	// and histogram timestamps are written relative to it.
+	BaseTime time.Time
+
+	// OmitLegend omits the legend from the header.
+	OmitLegend bool
+
+	// Comments are written at the start of the header.
+	Comments []string
+
+	// Tag is written for histograms that do not have a tag.
+	Tag string
+
+	// Precision is the resolution of timestamps and interval lengths.
+	// It must be one of time.Second, time.Millisecond, time.Microsecond,
+	// time.Nanosecond, or another power of ten nanoseconds in between.
+	// Zero means time.Millisecond.
+	Precision time.Duration
+}
+
+// precisionDigits returns the number of decimal digits needed
+// to write seconds with precision p.
+func precisionDigits(p time.Duration) int {
+	if p == 0 {
+		p = time.Millisecond
+	}
+	digits := 9
+	for d := time.Nanosecond; d < p; d *= 10 {
+		digits--
+	}
+	if digits < 0 || time.Duration(math.Pow10(9-digits)) != p {
+		panic("invalid LogWriterConfig: Precision must be a power of ten between time.Nanosecond and time.Second")
+	}
+	return digits
 }
 
 func NewLogWriter(w io.Writer) *LogWriter {
-	return &LogWriter{w: w}
+	return &LogWriter{w: w, digits: 3}
+}
+
+// NewLogWriterWithConfig creates a LogWriter with the provided config.
+// The header described by cfg is written by WriteHeader,
+// or along with the first histogram.
+func NewLogWriterWithConfig(w io.Writer, cfg LogWriterConfig) *LogWriter {
+	l := &LogWriter{
+		w:             w,
+		cfg:           cfg,
+		digits:        precisionDigits(cfg.Precision),
+		headerPending: true,
+	}
+	if !cfg.BaseTime.IsZero() {
+		l.SetBaseTime(cfg.BaseTime)
+	}
+	return l
+}
+
+// WriteHeader writes the header configured for l
+// unless it has already been written.
+func (l *LogWriter) WriteHeader() error {
+	if !l.headerPending {
+		return nil
+	}
+	l.headerPending = false
+	for _, c := range l.cfg.Comments {
+		if err := l.WriteComment(c); err != nil {
+			return err
+		}
+	}
+	if err := l.WriteComment("[Histogram log format version 1.3]"); err != nil {
+		return err
+	}
+	if !l.cfg.StartTime.IsZero() {
+		if err := l.WriteStartTime(l.cfg.StartTime); err != nil {
+			return err
+		}
+	}
+	if !l.cfg.BaseTime.IsZero() {
+		if err := l.WriteBaseTime(l.cfg.BaseTime); err != nil {
+			return err
+		}
+	}
+	if !l.cfg.OmitLegend {
+		return l.WriteLegend()
+	}
+	return nil
+}
+
+// Write writes h to the log, preceded by the header
+// if it has not been written yet.
+// Timestamps are written relative to the base time if one is set.
+func (l *LogWriter) Write(h *Hist) error {
+	if err := l.WriteHeader(); err != nil {
+		return err
+	}
+	t, ok := h.StartTime()
+	e, okEnd := h.EndTime()
+	t, e = l.relativeTimes(t, e, ok && okEnd)
+	return l.writeHist(l.tagFor(h.Tag()), h, t, e)
+}
+
+// WriteDouble is like Write but writes a DoubleHist.
+func (l *LogWriter) WriteDouble(d *DoubleHist) error {
+	if err := l.WriteHeader(); err != nil {
+		return err
+	}
+	return l.writeDouble(l.tagFor(d.Tag()), d)
+}
+
+func (l *LogWriter) tagFor(tag string) string {
+	if tag == "" {
+		return l.cfg.Tag
+	}
+	return tag
 }
 
 func (l *LogWriter) WriteStartTime(start time.Time) error {
 	const JavaDate = "Mon Jan 02 15:04:05 MST 2006"
 
-	sec := start.Unix()
-	millis := float64(start.Nanosecond()) / 1e6 // Java version only stores ms
-
-	_, err := fmt.Fprintf(l.w, "#[StartTime: %.3f (seconds since epoch), %s]\n",
-		float64(sec)+millis, start.Format(JavaDate))
+	var b bytes.Buffer
+	b.WriteString("#[StartTime: ")
+	appendTime(&b, start, l.digits)
+	fmt.Fprintf(&b, " (seconds since epoch), %s]\n", start.Format(JavaDate))
+	_, err := b.WriteTo(l.w)
 	return errors.Wrap(err, "unable to write start time")
 }
 
 func (l *LogWriter) WriteBaseTime(base time.Time) error {
-	sec := base.Unix()
-	millis := float64(base.Nanosecond()) / 1e6 // Java version only stores ms
-	_, err := fmt.Fprintf(l.w, "#[BaseTime: %.3f (seconds since epoch)]\n", float64(sec)+millis)
+	var b bytes.Buffer
+	b.WriteString("#[BaseTime: ")
+	appendTime(&b, base, l.digits)
+	b.WriteString(" (seconds since epoch)]\n")
+	_, err := b.WriteTo(l.w)
 	return errors.Wrap(err, "unable to write base time")
 }
 
@@ -81,29 +210,97 @@ func (l *LogWriter) GetBaseTime() (time.Time, bool) {
 func (l *LogWriter) WriteIntervalHist(h *Hist) error {
 	t, ok := h.StartTime()
 	e, okEnd := h.EndTime()
-	if ok && okEnd {
+	t, e = l.relativeTimes(t, e, ok && okEnd)
+	return l.writeHist(h.Tag(), h, t, e)
+}
+
+// relativeTimes makes start and end relative
+// to the base time if one is set.
+func (l *LogWriter) relativeTimes(start, end time.Time, ok bool) (time.Time, time.Time) {
+	if ok {
 		if b, ok := l.GetBaseTime(); ok {
-			d := t.Sub(b)
-			t = time.Unix(int64(d/time.Second), int64(d%time.Second))
-			d = e.Sub(b)
-			e = time.Unix(int64(d/time.Second), int64(d%time.Second))
+			d := start.Sub(b)
+			start = time.Unix(int64(d/time.Second), int64(d%time.Second))
+			d = end.Sub(b)
+			end = time.Unix(int64(d/time.Second), int64(d%time.Second))
 		}
 	}
-	return l.writeHist(h, t, e)
+	return start, end
+}
+
+// WriteIntervalDoubleHist is like WriteIntervalHist
+// but writes a DoubleHist.
+func (l *LogWriter) WriteIntervalDoubleHist(d *DoubleHist) error {
+	return l.writeDouble(d.Tag(), d)
+}
+
+func (l *LogWriter) writeDouble(tag string, d *DoubleHist) error {
+	t, ok := d.StartTime()
+	e, okEnd := d.EndTime()
+	t, e = l.relativeTimes(t, e, ok && okEnd)
+	return l.writeEncoded(tag, t, e, d.Max(), func(w io.Writer) {
+		encodeDoubleCompressed(d, w) // not writing to disk yet, won't fail
+	})
 }
 
-func (l *LogWriter) writeHist(h *Hist, start time.Time, end time.Time) error {
+func (l *LogWriter) writeHist(tag string, h *Hist, start time.Time, end time.Time) error {
+	max := h.Max()
+	return l.writeEncoded(tag, start, end, float64(max), func(w io.Writer) {
+		encodeCompressed(h, w, max) // not writing to disk yet, won't fail
+	})
+}
+
+// validTag reports whether tag can be written to a log.
+func validTag(tag string) bool {
+	return !strings.ContainsAny(tag, ", \r\n")
+}
+
+func (l *LogWriter) writeEncoded(tag string, start, end time.Time, max float64, encode func(w io.Writer)) error {
 	const MaxValueUnitRatio = 1000000.0
+	if !validTag(tag) {
+		return errors.Errorf("invalid tag %q: must not contain commas, spaces, or line breaks", tag)
+	}
 	l.buf.Reset()
-	max := h.Max()
-	fmt.Fprintf(&l.buf, "%.3f,%.3f,%.3f,",
-		float64(start.Unix())+(float64(start.Nanosecond()/1e6)/1e3),
-		float64(end.Sub(start)/time.Millisecond)/1e3,
-		float64(max)/MaxValueUnitRatio)
+	if tag != "" {
+		l.buf.WriteString("Tag=" + tag + ",")
+	}
+	appendTime(&l.buf, start, l.digits)
+	l.buf.WriteByte(',')
+	d := end.Sub(start)
+	appendSeconds(&l.buf, int64(d/time.Second), int64(d%time.Second), l.digits)
+	fmt.Fprintf(&l.buf, ",%.3f,", max/MaxValueUnitRatio)
 	b64w := base64.NewEncoder(base64.StdEncoding, &l.buf)
-	encodeCompressed(h, b64w, max) // not writing to disk yet, won't fail
+	encode(b64w)
 	b64w.Close()
 	l.buf.WriteString("\n")
 	_, err := l.buf.WriteTo(l.w)
 	return errors.Wrap(err, "unable to write hist")
 }
+
+// appendTime writes t as seconds since the epoch to buf
+// with the given number of digits after the decimal point.
+func appendTime(buf *bytes.Buffer, t time.Time, digits int) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	if sec < 0 && nsec > 0 {
+		sec, nsec = sec+1, nsec-1e9
+	}
+	appendSeconds(buf, sec, nsec, digits)
+}
+
+// appendSeconds writes sec+nsec/1e9 to buf with the given number
+// of digits after the decimal point, truncating the remaining digits.
+// nsec must have the same sign as sec.
+func appendSeconds(buf *bytes.Buffer, sec, nsec int64, digits int) {
+	if sec < 0 || nsec < 0 {
+		buf.WriteByte('-')
+		sec, nsec = -sec, -nsec
+	}
+	var b [20]byte
+	buf.Write(strconv.AppendInt(b[:0], sec, 10))
+	if digits == 0 {
+		return
+	}
+	frac := strconv.AppendInt(b[:0], nsec+1e9, 10) // keep leading zeros
+	buf.WriteByte('.')
+	buf.Write(frac[1 : 1+digits])
+}
@@ -0,0 +1,359 @@
+package hdrhist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// An envelope wraps an encoded histogram with the metadata
+// that the HdrHistogram encoding does not carry.
+//
+// The envelope is laid out as follows (all values are big-endian):
+//
+//     int32  envelopeCookie
+//     uint8  envelope version
+//     uint8  flags indicating which of the fields below are present
+//     int64  start time seconds since epoch
+//     int32  start time nanoseconds
+//     int64  end time seconds since epoch
+//     int32  end time nanoseconds
+//     int32  tag length
+//     ...    tag
+//     int64  exact min (version 2)
+//     int64  exact max (version 2)
+//     int64  high 64 bits of the exact sum (version 2)
+//     uint64 low 64 bits of the exact sum (version 2)
+//     ...    encoded histogram
+const (
+	envelopeCookie  = 0x48445245 // "HDRE"
+	envelopeVersion = 2
+
+	envelopeHasStart = 1 << 0
+	envelopeHasEnd   = 1 << 1
+	envelopeHasTag   = 1 << 2
+	envelopeHasStats = 1 << 3
+)
+
+// MarshalBinary encodes h in the compressed V2 format used by
+// Java's AbstractHistogram.encodeIntoCompressedByteBuffer.
+// The start and end times and the tag of h are not encoded,
+// see EncodeEnvelope for a way to preserve them.
+//
+// The decompressed contents are identical to those produced by Java,
+// but the compressed bytes may differ since a different
+// compression implementation is used.
+func (h *Hist) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := h.Encode(&buf, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the contents of h with those decoded from data.
+// data may contain any histogram accepted by Decode.
+func (h *Hist) UnmarshalBinary(data []byte) error {
+	h2, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*h = *h2
+	return nil
+}
+
+// Encode writes h to w in the V2 format.
+// If compressed is set, the compressed V2 format is used.
+func (h *Hist) Encode(w io.Writer, compressed bool) error {
+	if compressed {
+		return encodeCompressed(h, w, h.Max())
+	}
+	return encodeInto(h, w, h.Max())
+}
+
+// EncodeEnvelope is like Encode but precedes the histogram
+// with an envelope that stores its start and end times, its tag,
+// and the exact min, max, and sum of its values.
+// Histograms encoded using EncodeEnvelope can be read with Decode
+// but are not readable by other HdrHistogram implementations.
+func (h *Hist) EncodeEnvelope(w io.Writer, compressed bool) error {
+	var buf bytes.Buffer
+	var cookie int32 = envelopeCookie
+	binary.Write(&buf, binary.BigEndian, cookie)
+	buf.WriteByte(envelopeVersion)
+
+	var flags byte
+	if h.startTime.ok {
+		flags |= envelopeHasStart
+	}
+	if h.endTime.ok {
+		flags |= envelopeHasEnd
+	}
+	if h.tag != "" {
+		flags |= envelopeHasTag
+	}
+	if h.totalCount > 0 {
+		flags |= envelopeHasStats
+	}
+	buf.WriteByte(flags)
+	for _, t := range []optTime{h.startTime, h.endTime} {
+		if t.ok {
+			binary.Write(&buf, binary.BigEndian, t.t.Unix())
+			binary.Write(&buf, binary.BigEndian, int32(t.t.Nanosecond()))
+		}
+	}
+	if h.tag != "" {
+		binary.Write(&buf, binary.BigEndian, int32(len(h.tag)))
+		buf.WriteString(h.tag)
+	}
+	if flags&envelopeHasStats != 0 {
+		binary.Write(&buf, binary.BigEndian, []int64{h.min, h.max, h.sum.hi})
+		binary.Write(&buf, binary.BigEndian, h.sum.lo)
+	}
+
+	if err := h.Encode(&buf, compressed); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return errors.Wrap(err, "unable to write hist envelope")
+}
+
+// Decode reads a single histogram from r.
+// The histogram may be encoded in either the compressed or
+// uncompressed V0, V1, or V2 formats, and may be wrapped in an envelope
+// written by EncodeEnvelope.
+//
+// Decode reads exactly the bytes of one histogram from r,
+// so a sequence of histograms can be decoded from the same reader.
+// If r contains no more data, the cause of the returned error is io.EOF.
+//
+// Decode applies no limits beyond those implied by the encoding.
+// Use DecodeOptions.Decode to decode histograms from untrusted sources.
+func Decode(r io.Reader) (*Hist, error) {
+	return DecodeOptions{}.Decode(r)
+}
+
+// Decode is like the package level Decode but fails with a *LimitError
+// if the histogram exceeds the limits of opts.
+// Malformed histograms result in a *DecodeError,
+// which can be retrieved using errors.Cause.
+func (opts DecodeOptions) Decode(r io.Reader) (*Hist, error) {
+	d := decoder{opts: opts}
+	var cookie int32
+	if err := binary.Read(r, binary.BigEndian, &cookie); err != nil {
+		return nil, errors.Wrap(err, "unable to read cookie")
+	}
+
+	var start, end optTime
+	var tag string
+	var flags byte
+	var stats struct {
+		Min, Max, SumHi int64
+		SumLo           uint64
+	}
+	if cookie == envelopeCookie {
+		var hdr [2]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, wrapMalformed(err, "unable to read envelope")
+		}
+		if hdr[0] < 1 || hdr[0] > envelopeVersion {
+			return nil, malformedf("unsupported envelope version %d", hdr[0])
+		}
+		flags = hdr[1]
+		if hdr[0] < 2 {
+			flags &^= envelopeHasStats
+		}
+		for _, f := range []struct {
+			flag byte
+			dest *optTime
+			name string
+		}{
+			{envelopeHasStart, &start, "start time"},
+			{envelopeHasEnd, &end, "end time"},
+		} {
+			if flags&f.flag == 0 {
+				continue
+			}
+			var sec int64
+			var nsec int32
+			if err := binary.Read(r, binary.BigEndian, &sec); err != nil {
+				return nil, wrapMalformed(err, "unable to read "+f.name)
+			}
+			if err := binary.Read(r, binary.BigEndian, &nsec); err != nil {
+				return nil, wrapMalformed(err, "unable to read "+f.name)
+			}
+			*f.dest = optTime{time.Unix(sec, int64(nsec)), true}
+		}
+		if flags&envelopeHasTag != 0 {
+			var n int32
+			if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+				return nil, wrapMalformed(err, "unable to read tag length")
+			}
+			if n < 0 {
+				return nil, malformedf("invalid tag length %d", n)
+			}
+			b, err := readN(r, nil, int64(n))
+			if err != nil {
+				return nil, wrapMalformed(err, "unable to read tag")
+			}
+			tag = string(b)
+		}
+		if flags&envelopeHasStats != 0 {
+			if err := binary.Read(r, binary.BigEndian, &stats); err != nil {
+				return nil, wrapMalformed(err, "unable to read stats")
+			}
+		}
+		if err := binary.Read(r, binary.BigEndian, &cookie); err != nil {
+			return nil, wrapMalformed(err, "unable to read cookie")
+		}
+	}
+
+	buf, err := d.readEncoded(r, cookie)
+	if err != nil {
+		return nil, err
+	}
+	var h Hist
+	if _, err := d.decodeBuf(&h, buf); err != nil {
+		return nil, err
+	}
+	if flags&envelopeHasStats != 0 {
+		sum := int128{stats.SumHi, stats.SumLo}
+		if !h.validStats(stats.Min, stats.Max, sum) {
+			return nil, malformed("envelope stats do not match counts")
+		}
+		h.min, h.max, h.sum = stats.Min, stats.Max, sum
+	}
+	h.startTime = start
+	h.endTime = end
+	h.tag = tag
+	return &h, nil
+}
+
+// validStats reports whether min, max, and sum are consistent
+// with the counts of h, whose stats are derived from its counts.
+func (h *Hist) validStats(min, max int64, sum int128) bool {
+	return h.totalCount > 0 &&
+		0 <= min && min <= max &&
+		h.b.areEquiv(min, h.min) &&
+		h.b.areEquiv(max, h.max) &&
+		mul128(min, h.totalCount).cmp(sum) <= 0 &&
+		sum.cmp(mul128(max, h.totalCount)) <= 0
+}
+
+// readEncoded reads the remainder of an encoded histogram
+// whose cookie has already been read from r.
+// The returned buffer includes the cookie.
+func (d *decoder) readEncoded(r io.Reader, cookie int32) ([]byte, error) {
+	var restHeaderSize int
+	switch cookie & ^0xf0 {
+	case compressedEncodingV0CookieBase, compressedEncodingV1CookieBase, compressedEncodingV2CookieBase:
+		restHeaderSize = 4
+	case encodingV1CookieBase, encodingV2CookieBase:
+		restHeaderSize = encodingHeaderSize - 4
+	case encodingV0CookieBase:
+		restHeaderSize = encodingV0HeaderSize - 4
+	default:
+		return nil, malformed("no histogram in buffer")
+	}
+
+	buf := make([]byte, 4+restHeaderSize)
+	binary.BigEndian.PutUint32(buf, uint32(cookie))
+	if _, err := io.ReadFull(r, buf[4:]); err != nil {
+		return nil, wrapMalformed(err, "unable to read header")
+	}
+
+	if cookie & ^0xf0 == encodingV0CookieBase {
+		return d.readV0Payload(r, buf)
+	}
+	// The compressed format stores the length of the compressed data
+	// after the cookie, while the uncompressed format stores the length
+	// of the payload that follows the header.
+	n := int32(binary.BigEndian.Uint32(buf[4:]))
+	if n < 0 {
+		return nil, malformedf("invalid length %d", n)
+	}
+	if restHeaderSize != 4 {
+		if err := d.checkDecompressed(len(buf) + int(n)); err != nil {
+			return nil, err
+		}
+	}
+	buf, err := readN(r, buf, int64(n))
+	if err != nil {
+		return nil, wrapMalformed(err, "unable to read payload")
+	}
+	return buf, nil
+}
+
+// readN appends exactly n bytes read from r to buf.
+// buf grows as data arrives so that a corrupt length
+// does not result in a large allocation.
+func readN(r io.Reader, buf []byte, n int64) ([]byte, error) {
+	b := bytes.NewBuffer(buf)
+	m, err := b.ReadFrom(io.LimitReader(r, n))
+	if err == nil && m < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return b.Bytes(), err
+}
+
+// MarshalBinary encodes d in the compressed format used by
+// Java's DoubleHistogram.encodeIntoCompressedByteBuffer.
+func (d *DoubleHist) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.Encode(&buf, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the contents of d with those decoded from data.
+// data may contain a compressed or uncompressed double histogram.
+func (d *DoubleHist) UnmarshalBinary(data []byte) error {
+	var d2 DoubleHist
+	var dec decoder
+	if err := dec.decodeDouble(&d2, data); err != nil {
+		return err
+	}
+	*d = d2
+	return nil
+}
+
+// Encode writes d to w.
+// If compressed is set, the integer values are compressed.
+func (d *DoubleHist) Encode(w io.Writer, compressed bool) error {
+	if compressed {
+		return encodeDoubleCompressed(d, w)
+	}
+	return encodeDouble(d, w)
+}
+
+// readV0Payload reads the payload of an uncompressed V0 histogram
+// whose header is in buf.
+//
+// V0 headers do not contain the payload length,
+// so the full counts array of the histogram is read
+// unless r reaches EOF first.
+func (d *decoder) readV0Payload(r io.Reader, buf []byte) ([]byte, error) {
+	hdr, err := parseHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	cfg := hdr.config()
+	if err := cfg.validate(); err != nil {
+		return nil, wrapMalformed(err, "invalid header")
+	}
+	if err := d.checkCountsLen(cfg); err != nil {
+		return nil, err
+	}
+
+	b := cfg.layout()
+	n := b.countsLen() * wordByteCountFromCookie(hdr.cookie)
+	buf, err = readN(r, buf, int64(n))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, wrapMalformed(err, "unable to read payload")
+	}
+	return buf, nil
+}
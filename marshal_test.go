@@ -0,0 +1,174 @@
+package hdrhist
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+)
+
+func marshalTestHist() *Hist {
+	h := New(3)
+	for i := int64(0); i < 10000; i += 7 {
+		h.RecordN(i*i, i%5+1)
+	}
+	return h
+}
+
+func TestMarshalBinaryRoundTrip(t *testing.T) {
+	h := marshalTestHist()
+	b, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unable to marshal: %v", err)
+	}
+	var got Hist
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("unable to unmarshal: %v", err)
+	}
+	for _, p := range []float64{0, 1, 50, 90, 99.99, 100} {
+		if g, w := got.PercentileVal(p), h.PercentileVal(p); g != w {
+			t.Errorf("P%v: want %+v got %+v", p, w, g)
+		}
+	}
+}
+
+func TestEncodeCompressedMatchesUncompressed(t *testing.T) {
+	h := marshalTestHist()
+	var raw, compressed bytes.Buffer
+	if err := h.Encode(&raw, false); err != nil {
+		t.Fatalf("unable to encode uncompressed: %v", err)
+	}
+	if err := h.Encode(&compressed, true); err != nil {
+		t.Fatalf("unable to encode compressed: %v", err)
+	}
+
+	b := compressed.Bytes()
+	if cookie := binary.BigEndian.Uint32(b); cookie != compressedEncodingV2CookieBase|0x10 {
+		t.Errorf("compressed cookie: want %#x got %#x", compressedEncodingV2CookieBase|0x10, cookie)
+	}
+	if n := binary.BigEndian.Uint32(b[4:]); int(n) != len(b)-8 {
+		t.Errorf("compressed length: want %d got %d", len(b)-8, n)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(b[8:]))
+	if err != nil {
+		t.Fatalf("unable to create decompressor: %v", err)
+	}
+	decompressed, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("unable to decompress: %v", err)
+	}
+	if !bytes.Equal(decompressed, raw.Bytes()) {
+		t.Error("decompressed payload does not match uncompressed encoding")
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	h1 := marshalTestHist()
+	h2 := New(2)
+	h2.Record(42)
+	start := time.Unix(1500000000, 123456789)
+	end := start.Add(1500 * time.Millisecond)
+	h2.SetStartTime(start)
+	h2.SetEndTime(end)
+	h2.SetTag("tagged")
+
+	var buf bytes.Buffer
+	if err := h1.Encode(&buf, false); err != nil {
+		t.Fatalf("unable to encode h1: %v", err)
+	}
+	if err := h2.EncodeEnvelope(&buf, true); err != nil {
+		t.Fatalf("unable to encode h2: %v", err)
+	}
+	if err := h1.EncodeEnvelope(&buf, false); err != nil {
+		t.Fatalf("unable to encode h1: %v", err)
+	}
+
+	for i, want := range []*Hist{h1, h2, h1} {
+		got, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("hist %d: unable to decode: %v", i, err)
+		}
+		// AutoResize is not part of the encoding
+		got.SetAutoResize(want.Config().AutoResize)
+		if err := sameHistsNoTime(want, got); err != nil {
+			t.Errorf("hist %d: %v", i, err)
+		}
+		wantStart, wantOK := want.StartTime()
+		gotStart, gotOK := got.StartTime()
+		if i != 0 && (wantOK != gotOK || !wantStart.Equal(gotStart)) {
+			t.Errorf("hist %d: start time: want %v got %v", i, wantStart, gotStart)
+		}
+		if g, w := got.Tag(), want.Tag(); i != 0 && g != w {
+			t.Errorf("hist %d: tag: want %q got %q", i, w, g)
+		}
+		wantEnd, wantOK := want.EndTime()
+		gotEnd, gotOK := got.EndTime()
+		if i != 0 && (wantOK != gotOK || !wantEnd.Equal(gotEnd)) {
+			t.Errorf("hist %d: end time: want %v got %v", i, wantEnd, gotEnd)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("want all input consumed, %d bytes left", buf.Len())
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	h := marshalTestHist()
+	b, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unable to marshal: %v", err)
+	}
+	for _, data := range [][]byte{nil, b[:3], b[:8], b[:len(b)-1]} {
+		var got Hist
+		if err := got.UnmarshalBinary(data); err == nil {
+			t.Errorf("want error decoding %d bytes", len(data))
+		}
+	}
+}
+
+func TestEnvelopeExactStats(t *testing.T) {
+	h := New(2)
+	h.Record(1001)
+	h.RecordN(12345, 2)
+	h.Record(99999)
+
+	var plain, env bytes.Buffer
+	if err := h.Encode(&plain, true); err != nil {
+		t.Fatalf("unable to encode: %v", err)
+	}
+	if err := h.EncodeEnvelope(&env, true); err != nil {
+		t.Fatalf("unable to encode envelope: %v", err)
+	}
+	envBytes := append([]byte(nil), env.Bytes()...)
+
+	got, err := Decode(&env)
+	if err != nil {
+		t.Fatalf("unable to decode envelope: %v", err)
+	}
+	if got.ExactMin() != 1001 || got.ExactMax() != 99999 || got.ExactMean() != 31422.5 {
+		t.Errorf("envelope: got min %d max %d mean %v, want 1001, 99999, 31422.5",
+			got.ExactMin(), got.ExactMax(), got.ExactMean())
+	}
+
+	// Without the envelope, the stats are derived from the buckets.
+	got, err = Decode(&plain)
+	if err != nil {
+		t.Fatalf("unable to decode: %v", err)
+	}
+	if got.ExactMin() != h.Min() || got.ExactMax() != h.Max() {
+		t.Errorf("plain: got min %d max %d, want %d, %d", got.ExactMin(), got.ExactMax(), h.Min(), h.Max())
+	}
+	if m := got.ExactMean(); math.Abs(m-31422.5) > 31422.5*0.01 {
+		t.Errorf("plain: got mean %v, want about 31422.5", m)
+	}
+
+	// Stats that don't match the counts are rejected.
+	// They follow the cookie, version, and flags.
+	binary.BigEndian.PutUint64(envBytes[6:], 5000)
+	if _, err := Decode(bytes.NewReader(envBytes)); err == nil {
+		t.Error("want error decoding envelope with invalid min")
+	}
+}
@@ -0,0 +1,243 @@
+package hdrhist
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A ParallelLogReader reads hists from a log like a LogReader,
+// but decodes them on several goroutines.
+// Histograms are still returned in the order they appear in the log.
+//
+// Lines are split and parsed on a single goroutine,
+// so ParallelLogReader helps most when decoding dominates,
+// as it does for logs with large histograms.
+type ParallelLogReader struct {
+	l     *LogReader
+	items chan *logItem
+	quit  chan struct{}
+	read  chan struct{} // closed once l is no longer read
+
+	stopOnce sync.Once
+
+	cur         *Hist
+	curDouble   *DoubleHist
+	comments    []string
+	err         error
+	parseErrors []*LogParseError
+}
+
+// logItem is a line on its way through a ParallelLogReader.
+type logItem struct {
+	e        logEntry
+	comments []string // comments preceding the histogram
+	h        *Hist
+	d        *DoubleHist
+	err      error
+	done     chan struct{} // closed once decoded, nil if there is nothing to decode
+}
+
+// NewParallelLogReader creates a ParallelLogReader that reads the
+// histograms of l using the given number of decoding goroutines
+// (runtime.GOMAXPROCS if workers <= 0).
+//
+// The configuration of l (FilterTag, SetWindow, SetDecodeOptions,
+// SetLenient, SetDoubleHists, and so on) applies to the ParallelLogReader.
+// l must not be used while the ParallelLogReader is in use.
+// Its StartTime, BaseTime, Legend, and Comments are available from the
+// methods of the same names of the ParallelLogReader.
+func NewParallelLogReader(l *LogReader, workers int) *ParallelLogReader {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &ParallelLogReader{
+		l:     l,
+		items: make(chan *logItem, 4*workers),
+		quit:  make(chan struct{}),
+		read:  make(chan struct{}),
+		err:   l.err,
+	}
+	jobs := make(chan *logItem, workers)
+	for i := 0; i < workers; i++ {
+		go decodeItems(jobs, decoder{opts: l.dec.opts})
+	}
+	go p.parse(jobs)
+	return p
+}
+
+// parse splits and parses the lines of the log,
+// passing histograms to be decoded to jobs.
+func (p *ParallelLogReader) parse(jobs chan<- *logItem) {
+	defer close(p.read)
+	defer close(p.items)
+	defer close(jobs)
+
+	l := p.l
+	if l.err != nil || l.pastEnd {
+		return
+	}
+	var e logEntry
+	for l.s.Scan() {
+		ok, perr := l.parseLine(l.s.Bytes(), &e)
+		var it *logItem
+		switch {
+		case perr != nil:
+			it = &logItem{err: perr}
+		case ok:
+			// The scanner reuses its buffer, so keep a copy of the line.
+			off := fieldOff(e.text, e.payload)
+			text := append([]byte(nil), e.text...)
+			e.payload = text[off : off+len(e.payload)]
+			e.text = text
+			it = &logItem{e: e, comments: l.comments, done: make(chan struct{})}
+			l.comments = nil
+		}
+		if it != nil && !p.send(jobs, it) {
+			return
+		}
+		if (perr != nil && !l.lenient) || l.pastEnd {
+			return
+		}
+	}
+	if err := l.s.Err(); err != nil {
+		p.send(jobs, &logItem{err: errors.Wrap(err, "unable to read log")})
+	}
+}
+
+// send queues it for Scan and, if needed, for decoding.
+// It reports false if the ParallelLogReader has been stopped.
+func (p *ParallelLogReader) send(jobs chan<- *logItem, it *logItem) bool {
+	select {
+	case p.items <- it:
+	case <-p.quit:
+		return false
+	}
+	if it.done == nil {
+		return true
+	}
+	select {
+	case jobs <- it:
+		return true
+	case <-p.quit:
+		return false
+	}
+}
+
+func decodeItems(jobs <-chan *logItem, dec decoder) {
+	for it := range jobs {
+		var perr *LogParseError
+		it.h, it.d, perr = dec.decodeEntry(&it.e, nil)
+		if perr != nil {
+			it.err = perr
+		}
+		it.e = logEntry{}
+		close(it.done)
+	}
+}
+
+// Scan reads the next histogram from the log,
+// which is then available from Hist,
+// or from DoubleHist if enabled by SetDoubleHists on the LogReader.
+// It returns false at the end of the log or on error.
+func (p *ParallelLogReader) Scan() bool {
+	if p.err != nil {
+		return false
+	}
+	for it := range p.items {
+		if it.done != nil {
+			<-it.done
+		}
+		if it.err != nil {
+			if perr, ok := it.err.(*LogParseError); ok && p.l.lenient {
+				p.parseErrors = append(p.parseErrors, perr)
+				continue
+			}
+			p.err = it.err
+			p.comments = nil
+			p.stop()
+			return false
+		}
+		p.cur = it.h
+		p.curDouble = it.d
+		p.comments = it.comments
+		return true
+	}
+	// items is closed once the log is no longer read
+	p.comments = p.l.comments
+	return false
+}
+
+// Hist returns the most recently scanned histogram.
+// It returns nil if the histogram is a double histogram
+// returned because of SetDoubleHists,
+// in which case it is available from DoubleHist.
+//
+// Unlike with LogReader, each histogram is newly allocated.
+func (p *ParallelLogReader) Hist() *Hist {
+	return p.cur
+}
+
+// DoubleHist returns the most recently scanned histogram
+// if it is a double histogram, and nil otherwise.
+func (p *ParallelLogReader) DoubleHist() *DoubleHist {
+	return p.curDouble
+}
+
+// Err returns the error that stopped Scan, if any.
+// Errors in the log are reported as a *LogParseError
+// that gives the position of the error.
+func (p *ParallelLogReader) Err() error {
+	return p.err
+}
+
+// ParseErrors returns the errors of the lines skipped in lenient mode
+// up to the most recently scanned histogram.
+func (p *ParallelLogReader) ParseErrors() []*LogParseError {
+	return p.parseErrors
+}
+
+// Comments returns the comments read before the most recently
+// scanned histogram as by LogReader.Comments.
+func (p *ParallelLogReader) Comments() []string {
+	return p.comments
+}
+
+// StartTime returns the start time of the log as by LogReader.StartTime.
+//
+// StartTime, BaseTime, and Legend may only be called once Scan
+// returns false or after Close. They wait until the log is no
+// longer being read, which after an error or Close may take until
+// a pending read of the underlying reader returns.
+func (p *ParallelLogReader) StartTime() (t time.Time, ok bool) {
+	<-p.read
+	return p.l.StartTime()
+}
+
+// BaseTime returns the base time of the log as by LogReader.BaseTime.
+// See StartTime for when it may be called.
+func (p *ParallelLogReader) BaseTime() (t time.Time, ok bool) {
+	<-p.read
+	return p.l.BaseTime()
+}
+
+// Legend returns the legend of the log as by LogReader.Legend.
+// See StartTime for when it may be called.
+func (p *ParallelLogReader) Legend() []string {
+	<-p.read
+	return p.l.Legend()
+}
+
+// Close stops decoding.
+// It does not wait for a pending read of the underlying log,
+// so the LogReader must not be used after Close.
+func (p *ParallelLogReader) Close() error {
+	p.stop()
+	return nil
+}
+
+func (p *ParallelLogReader) stop() {
+	p.stopOnce.Do(func() { close(p.quit) })
+}
@@ -0,0 +1,179 @@
+package hdrhist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParallelLogReader(t *testing.T) {
+	data := scanIntoTestLog(t, 50)
+	for _, workers := range []int{0, 1, 3, 16} {
+		want := NewLogReader(bytes.NewReader(data))
+		p := NewParallelLogReader(NewLogReader(bytes.NewReader(data)), workers)
+		n := 0
+		for p.Scan() {
+			if !want.Scan() {
+				t.Fatalf("workers=%d: too many hists", workers)
+			}
+			if err := sameHistsNoTime(p.Hist(), want.Hist()); err != nil {
+				t.Errorf("workers=%d: hist %d: %v", workers, n, err)
+			}
+			if p.Hist().Tag() != want.Hist().Tag() {
+				t.Errorf("workers=%d: hist %d: got tag %q, want %q", workers, n, p.Hist().Tag(), want.Hist().Tag())
+			}
+			st, _ := p.Hist().StartTime()
+			wst, _ := want.Hist().StartTime()
+			if !st.Equal(wst) {
+				t.Errorf("workers=%d: hist %d: got start %v, want %v", workers, n, st, wst)
+			}
+			n++
+		}
+		if err := p.Err(); err != nil {
+			t.Fatalf("workers=%d: %v", workers, err)
+		}
+		if want.Scan() || n != 50 {
+			t.Errorf("workers=%d: got %d hists, want 50", workers, n)
+		}
+		p.Close()
+	}
+}
+
+func TestParallelLogReaderComments(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf)
+	for _, c := range []struct{ comment, tag string }{
+		{"a", "x"},
+		{"b", "y"},
+		{"c", "x"},
+		{"d", ""},
+		{"e", "x"},
+	} {
+		w.WriteComment(c.comment)
+		if c.tag == "" {
+			// fails to decode
+			buf.WriteString("Tag=x,0.000,1.000,1.000,AAAAAAAA\n")
+			continue
+		}
+		h := New(2)
+		h.Record(1)
+		h.SetTag(c.tag)
+		if err := w.WriteIntervalHist(h); err != nil {
+			t.Fatalf("unable to write hist: %v", err)
+		}
+	}
+	w.WriteComment("done")
+
+	l := NewLogReader(&buf)
+	l.FilterTag("x")
+	l.SetLenient(true)
+	p := NewParallelLogReader(l, 2)
+	defer p.Close()
+	for i, want := range [][]string{{"a"}, {"c"}, {"e"}} {
+		if !p.Scan() {
+			t.Fatalf("hist %d: want hist, got error: %v", i, p.Err())
+		}
+		if c := p.Comments(); fmt.Sprintf("%q", c) != fmt.Sprintf("%q", want) {
+			t.Errorf("hist %d: want comments %q got %q", i, want, c)
+		}
+	}
+	if p.Scan() {
+		t.Fatal("want no more hists")
+	}
+	if len(p.ParseErrors()) != 1 {
+		t.Errorf("want 1 parse error, got %v", p.ParseErrors())
+	}
+	if c := p.Comments(); len(c) != 1 || c[0] != "done" {
+		t.Errorf("want trailing comment done, got %q", c)
+	}
+}
+
+func TestParallelLogReaderErrors(t *testing.T) {
+	data := scanIntoTestLog(t, 20)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	// Corrupt the payloads of lines 5 and 12.
+	for _, i := range []int{4, 11} {
+		f := bytes.LastIndexByte(lines[i], ',')
+		lines[i] = append(lines[i][:f+1:f+1], "!!!!\n"...)
+	}
+	data = bytes.Join(lines, nil)
+
+	p := NewParallelLogReader(NewLogReader(bytes.NewReader(data)), 4)
+	n := 0
+	for p.Scan() {
+		n++
+	}
+	perr, ok := p.Err().(*LogParseError)
+	if !ok {
+		t.Fatalf("got error %v, want *LogParseError", p.Err())
+	}
+	if n != 4 || perr.Line != 5 {
+		t.Errorf("got %d hists and error at line %d, want 4 and line 5", n, perr.Line)
+	}
+	if p.Scan() {
+		t.Error("Scan returned true after error")
+	}
+
+	lr := NewLogReader(bytes.NewReader(data))
+	lr.SetLenient(true)
+	p = NewParallelLogReader(lr, 4)
+	n = 0
+	for p.Scan() {
+		n++
+	}
+	if err := p.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 18 {
+		t.Errorf("got %d hists, want 18", n)
+	}
+	errs := p.ParseErrors()
+	if len(errs) != 2 || errs[0].Line != 5 || errs[1].Line != 12 {
+		t.Errorf("got parse errors %v, want lines 5 and 12", errs)
+	}
+}
+
+func TestParallelLogReaderErrorBlockedRead(t *testing.T) {
+	// The payload fails to decode while the parser
+	// waits for more data that never arrives.
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("#[StartTime: 100.000 (seconds since epoch)]\n0.000,1.000,2.000,!!!!\n"))
+	p := NewParallelLogReader(NewLogReader(pr), 2)
+	scanned := make(chan bool)
+	go func() { scanned <- p.Scan() }()
+	select {
+	case ok := <-scanned:
+		if ok {
+			t.Fatal("Scan returned true for a malformed hist")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Scan blocked on the pending read after an error")
+	}
+	if _, ok := p.Err().(*LogParseError); !ok {
+		t.Errorf("got error %v, want *LogParseError", p.Err())
+	}
+
+	// The log accessors wait for the pending read.
+	pw.Close()
+	if st, ok := p.StartTime(); !ok || !st.Equal(time.Unix(100, 0)) {
+		t.Errorf("got start time %v, %t, want %v", st, ok, time.Unix(100, 0))
+	}
+	p.Close()
+}
+
+func BenchmarkParallelLogReader(b *testing.B) {
+	data := scanIntoTestLog(b, 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; {
+		p := NewParallelLogReader(NewLogReader(bytes.NewReader(data)), 0)
+		for ; i < b.N && p.Scan(); i++ {
+		}
+		if p.Err() != nil {
+			b.Fatal(p.Err())
+		}
+		p.Close()
+	}
+}
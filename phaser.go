@@ -0,0 +1,85 @@
+package hdrhist
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+This file was ported from the Java source of HdrHistogram written
+by Gil Tene. See https://hdrhistogram.github.io/HdrHistogram/.
+
+A phaser provides an asymmetric means for synchronizing the execution
+of wait-free "writer" critical sections against a "reader phase flip"
+that needs to make sure no writer is still operating on data
+from the previous phase.
+
+Writers bracket their critical sections with writerEnter and writerExit.
+Both are wait-free (a single atomic add each).
+Readers must hold the reader lock (see readerLock and readerUnlock)
+while calling flipPhase, which blocks until every writer that entered
+before the flip has exited.
+*/
+type phaser struct {
+	startEpoch   int64
+	evenEndEpoch int64
+	oddEndEpoch  int64
+
+	mu sync.Mutex
+}
+
+func newPhaser() *phaser {
+	return &phaser{oddEndEpoch: math.MinInt64}
+}
+
+// writerEnter marks the start of a writer critical section
+// and returns a value that must be passed to writerExit.
+func (p *phaser) writerEnter() int64 {
+	return atomic.AddInt64(&p.startEpoch, 1) - 1
+}
+
+// writerExit marks the end of a writer critical section.
+func (p *phaser) writerExit(critVal int64) {
+	if critVal < 0 {
+		atomic.AddInt64(&p.oddEndEpoch, 1)
+	} else {
+		atomic.AddInt64(&p.evenEndEpoch, 1)
+	}
+}
+
+func (p *phaser) readerLock()   { p.mu.Lock() }
+func (p *phaser) readerUnlock() { p.mu.Unlock() }
+
+// flipPhase flips the phase and waits for all writers
+// that were active in the previous phase to exit.
+// The reader lock must be held.
+func (p *phaser) flipPhase() {
+	nextPhaseIsEven := atomic.LoadInt64(&p.startEpoch) < 0
+
+	// clear the end epoch of the next phase
+	var initialStartValue int64
+	if nextPhaseIsEven {
+		initialStartValue = 0
+		atomic.StoreInt64(&p.evenEndEpoch, initialStartValue)
+	} else {
+		initialStartValue = math.MinInt64
+		atomic.StoreInt64(&p.oddEndEpoch, initialStartValue)
+	}
+
+	startValueAtFlip := atomic.SwapInt64(&p.startEpoch, initialStartValue)
+
+	for {
+		var caughtUp bool
+		if nextPhaseIsEven {
+			caughtUp = atomic.LoadInt64(&p.oddEndEpoch) == startValueAtFlip
+		} else {
+			caughtUp = atomic.LoadInt64(&p.evenEndEpoch) == startValueAtFlip
+		}
+		if caughtUp {
+			return
+		}
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,120 @@
+package hdrhist
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Recorder provides a recording-only convenience API for snapshotting Hists.
+//
+// Recorder is safe for concurrent use.
+// Record, RecordN, and RecordCorrected are wait-free
+// (unless the underlying histogram needs to be resized)
+// and may be called while another goroutine calls IntervalHist.
+//
+// Recorder maintains an active and an inactive histogram.
+// IntervalHist flips the two and waits only for writers
+// that are still recording into the previously active histogram.
+type Recorder struct {
+	active   atomic.Value // *AtomicHist
+	inactive *AtomicHist
+
+	startTime time.Time
+	tag       string
+	p         *phaser
+}
+
+func NewRecorder(sigfigs int32) *Recorder {
+	return NewRecorderWithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  2,
+		SigFigs:           sigfigs,
+		AutoResize:        true,
+	})
+}
+
+func NewRecorderWithConfig(cfg Config) *Recorder {
+	var r Recorder
+	r.Init(cfg)
+	return &r
+}
+
+// Init initializes the Recorder with the given Config.
+// Init must not be called concurrently with any other method.
+func (r *Recorder) Init(cfg Config) {
+	r.active.Store(NewAtomicHistWithConfig(cfg))
+	r.inactive = NewAtomicHistWithConfig(cfg)
+	r.startTime = time.Now()
+	r.tag = ""
+	r.p = newPhaser()
+}
+
+func (r *Recorder) loadActive() *AtomicHist {
+	return r.active.Load().(*AtomicHist)
+}
+
+// Clear deletes all recorded values and restarts the current interval.
+func (r *Recorder) Clear() {
+	r.p.readerLock()
+	defer r.p.readerUnlock()
+
+	r.loadActive().Clear()
+	r.startTime = time.Now()
+}
+
+// Tag returns the tag given to interval histograms.
+func (r *Recorder) Tag() string {
+	r.p.readerLock()
+	defer r.p.readerUnlock()
+	return r.tag
+}
+
+// SetTag sets the tag given to interval histograms.
+func (r *Recorder) SetTag(tag string) {
+	r.p.readerLock()
+	defer r.p.readerUnlock()
+	r.tag = tag
+}
+
+func (r *Recorder) Record(v int64) { r.RecordN(v, 1) }
+
+func (r *Recorder) RecordN(v, count int64) {
+	critVal := r.p.writerEnter()
+	defer r.p.writerExit(critVal)
+	r.loadActive().RecordN(v, count)
+}
+
+func (r *Recorder) RecordCorrected(v int64, expectedInterval int64) {
+	critVal := r.p.writerEnter()
+	defer r.p.writerExit(critVal)
+	r.loadActive().RecordCorrected(v, expectedInterval)
+}
+
+// IntervalHist returns a Hist containing all values recorded
+// since the last call to IntervalHist (or since Init),
+// and resets the Recorder.
+//
+// If h is non-nil, its memory is reused and h is returned.
+// Otherwise, a new Hist is allocated.
+// The start and end times of the returned Hist
+// are set to the bounds of the interval
+// and its tag is set to that of the Recorder.
+func (r *Recorder) IntervalHist(h *Hist) *Hist {
+	r.p.readerLock()
+	defer r.p.readerUnlock()
+
+	prev := r.loadActive()
+	r.active.Store(r.inactive)
+	r.inactive = prev
+	now := time.Now()
+	r.p.flipPhase()
+
+	// no writers remain in prev
+	h = prev.Snapshot(h)
+	prev.Clear()
+	h.SetStartTime(r.startTime)
+	h.SetEndTime(now)
+	h.SetTag(r.tag)
+	r.startTime = now
+	return h
+}
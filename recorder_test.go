@@ -0,0 +1,170 @@
+package hdrhist
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type intervalRecorder interface {
+	Record(v int64)
+	SetTag(tag string)
+	IntervalHist(h *Hist) *Hist
+}
+
+func TestRecorderConcurrentIntervals(t *testing.T) {
+	testConcurrentIntervals(t, NewRecorder(3))
+}
+
+func TestShardedRecorderConcurrentIntervals(t *testing.T) {
+	r := NewShardedRecorder(3)
+	r.InitShards(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  2,
+		SigFigs:           3,
+		AutoResize:        true,
+	}, 3)
+	testConcurrentIntervals(t, r)
+}
+
+func testConcurrentIntervals(t *testing.T, r intervalRecorder) {
+	const (
+		writers   = 4
+		perWriter = 20000
+	)
+
+	var wg sync.WaitGroup
+	var done int32
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				r.Record(int64(i*writers + w))
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		atomic.StoreInt32(&done, 1)
+	}()
+
+	sum := New(3)
+	var h *Hist
+	for atomic.LoadInt32(&done) == 0 {
+		h = r.IntervalHist(h)
+		sum.Add(h)
+	}
+	sum.Add(r.IntervalHist(h))
+
+	want := New(3)
+	for i := 0; i < writers*perWriter; i++ {
+		want.Record(int64(i))
+	}
+	if sum.TotalCount() != want.TotalCount() {
+		t.Fatalf("total count: want %d got %d", want.TotalCount(), sum.TotalCount())
+	}
+	for _, p := range []float64{0, 25, 50, 75, 99, 100} {
+		if g, w := sum.PercentileVal(p), want.PercentileVal(p); g != w {
+			t.Errorf("P%v: want %+v got %+v", p, w, g)
+		}
+	}
+}
+
+func TestRecorderIntervalTimes(t *testing.T) {
+	testIntervalTimes(t, NewRecorder(2))
+}
+
+func TestShardedRecorderIntervalTimes(t *testing.T) {
+	testIntervalTimes(t, NewShardedRecorder(2))
+}
+
+func testIntervalTimes(t *testing.T, r intervalRecorder) {
+	r.Record(5)
+	h1 := r.IntervalHist(nil)
+	h2 := r.IntervalHist(nil)
+
+	end1, ok := h1.EndTime()
+	if !ok {
+		t.Fatal("first interval has no end time")
+	}
+	start2, ok := h2.StartTime()
+	if !ok {
+		t.Fatal("second interval has no start time")
+	}
+	if !end1.Equal(start2) {
+		t.Errorf("intervals are not contiguous: %v vs %v", end1, start2)
+	}
+	if c := h2.TotalCount(); c != 0 {
+		t.Errorf("second interval: want 0 values got %d", c)
+	}
+}
+
+func TestRecorderIntervalTag(t *testing.T) {
+	testIntervalTag(t, NewRecorder(2))
+}
+
+func TestShardedRecorderIntervalTag(t *testing.T) {
+	testIntervalTag(t, NewShardedRecorder(2))
+}
+
+func testIntervalTag(t *testing.T, r intervalRecorder) {
+	r.SetTag("api")
+	r.Record(5)
+	h := New(2)
+	h.SetTag("stale")
+	if tag := r.IntervalHist(h).Tag(); tag != "api" {
+		t.Errorf("want tag api got %q", tag)
+	}
+	r.SetTag("")
+	if tag := r.IntervalHist(h).Tag(); tag != "" {
+		t.Errorf("want no tag got %q", tag)
+	}
+}
+
+func TestRecorderRecoveredPanic(t *testing.T) {
+	testRecoveredPanic(t, NewRecorderWithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1000,
+		SigFigs:           2,
+	}))
+}
+
+func TestShardedRecorderRecoveredPanic(t *testing.T) {
+	// A single shard is used by both the panicking and the next record.
+	r := NewShardedRecorder(2)
+	r.InitShards(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  1000,
+		SigFigs:           2,
+	}, 1)
+	testRecoveredPanic(t, r)
+}
+
+// testRecoveredPanic checks that r remains usable after
+// recording a value that is too large panics and is recovered.
+func testRecoveredPanic(t *testing.T, r intervalRecorder) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("want panic recording a value that is too large")
+			}
+		}()
+		r.Record(1e9)
+	}()
+
+	done := make(chan *Hist)
+	go func() {
+		r.Record(5)
+		done <- r.IntervalHist(nil)
+	}()
+	select {
+	case h := <-done:
+		if c := h.TotalCount(); c != 1 {
+			t.Errorf("want 1 value got %d", c)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("recorder blocked after a recovered panic")
+	}
+}
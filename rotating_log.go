@@ -0,0 +1,229 @@
+package hdrhist
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RotatingLogWriterConfig configures a RotatingLogWriter.
+type RotatingLogWriterConfig struct {
+	// Path determines the names of log files.
+	// Each file is named after Path with the time the file was
+	// created inserted before the extension, so a Path of
+	// "dir/latency.hlog" results in files such as
+	// "dir/latency-20170714T024000.000Z.hlog".
+	// If a file of that name already exists, a counter is added,
+	// as in "dir/latency-20170714T024000.000Z_001.hlog",
+	// so that files sort in the order they were created.
+	Path string
+
+	// MaxSize is the size in bytes after which a new file is started.
+	// Zero means no limit.
+	MaxSize int64
+
+	// MaxAge is the age after which a new file is started.
+	// Zero means no limit.
+	MaxAge time.Duration
+
+	// Compress gzip-compresses completed files,
+	// which are renamed to have a ".gz" suffix.
+	Compress bool
+
+	// Log configures the header written to each file.
+	// Files share the same StartTime and BaseTime,
+	// so timestamps in all files are relative to the same base.
+	// If Log.StartTime or Log.BaseTime is zero, the time the
+	// RotatingLogWriter is created is used.
+	Log LogWriterConfig
+
+	// Clock determines file ages and names. Nil means SystemClock.
+	Clock Clock
+}
+
+// A RotatingLogWriter writes a log split across several files.
+// Each file is a complete log, including the header.
+//
+// Files are only rotated between histograms,
+// so a file may exceed MaxSize by up to one histogram.
+type RotatingLogWriter struct {
+	cfg RotatingLogWriterConfig
+
+	f       *os.File
+	name    string
+	size    int64
+	created time.Time
+	w       *LogWriter
+}
+
+// NewRotatingLogWriter creates a RotatingLogWriter
+// and the first file of its log.
+func NewRotatingLogWriter(cfg RotatingLogWriterConfig) (*RotatingLogWriter, error) {
+	if cfg.Path == "" {
+		panic("invalid RotatingLogWriterConfig: Path must be set")
+	}
+	if cfg.MaxSize < 0 || cfg.MaxAge < 0 {
+		panic("invalid RotatingLogWriterConfig: MaxSize and MaxAge must be >= 0")
+	}
+	precisionDigits(cfg.Log.Precision) // validate early
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	now := cfg.Clock.Now()
+	if cfg.Log.StartTime.IsZero() {
+		cfg.Log.StartTime = now
+	}
+	if cfg.Log.BaseTime.IsZero() {
+		cfg.Log.BaseTime = now
+	}
+	l := &RotatingLogWriter{cfg: cfg}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Name returns the name of the file currently being written.
+func (l *RotatingLogWriter) Name() string { return l.name }
+
+func (l *RotatingLogWriter) Write(h *Hist) error {
+	if err := l.maybeRotate(); err != nil {
+		return err
+	}
+	return l.w.Write(h)
+}
+
+// WriteDouble is like Write but writes a DoubleHist.
+func (l *RotatingLogWriter) WriteDouble(d *DoubleHist) error {
+	if err := l.maybeRotate(); err != nil {
+		return err
+	}
+	return l.w.WriteDouble(d)
+}
+
+// WriteComment writes a comment to the current file,
+// preceded by the header if it has not been written yet.
+func (l *RotatingLogWriter) WriteComment(text string) error {
+	if err := l.w.WriteHeader(); err != nil {
+		return err
+	}
+	return l.w.WriteComment(text)
+}
+
+// Rotate completes the current file and starts a new one.
+func (l *RotatingLogWriter) Rotate() error {
+	if err := l.closeFile(); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Close completes the current file.
+// The RotatingLogWriter must not be used after Close.
+func (l *RotatingLogWriter) Close() error {
+	return l.closeFile()
+}
+
+func (l *RotatingLogWriter) maybeRotate() error {
+	if l.size == 0 {
+		return nil // nothing written yet, keep the file
+	}
+	if (l.cfg.MaxSize > 0 && l.size >= l.cfg.MaxSize) ||
+		(l.cfg.MaxAge > 0 && l.cfg.Clock.Now().Sub(l.created) >= l.cfg.MaxAge) {
+		return l.Rotate()
+	}
+	return nil
+}
+
+func (l *RotatingLogWriter) open() error {
+	l.created = l.cfg.Clock.Now()
+	ext := filepath.Ext(l.cfg.Path)
+	base := strings.TrimSuffix(l.cfg.Path, ext) + "-" +
+		l.created.UTC().Format("20060102T150405.000Z")
+	name := base + ext
+	for i := 1; ; i++ {
+		// Don't reuse the name of a file that was already compressed.
+		if _, err := os.Stat(name + ".gz"); err == nil {
+			name = base + fmt.Sprintf("_%03d", i) + ext
+			continue
+		}
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			name = base + fmt.Sprintf("_%03d", i) + ext
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to create log file")
+		}
+		l.f = f
+		break
+	}
+	l.name = name
+	l.size = 0
+	l.w = NewLogWriterWithConfig(countWriter{l.f, &l.size}, l.cfg.Log)
+	return nil
+}
+
+func (l *RotatingLogWriter) closeFile() error {
+	if l.f == nil {
+		return nil
+	}
+	f := l.f
+	l.f = nil
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "unable to close log file")
+	}
+	if l.cfg.Compress {
+		return gzipFile(l.name)
+	}
+	return nil
+}
+
+// gzipFile compresses name into name.gz and removes name.
+func gzipFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return errors.Wrap(err, "unable to compress log file")
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to compress log file")
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(name + ".gz")
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(name)
+	if _, err := io.Copy(zw, src); err != nil {
+		return errors.Wrap(err, "unable to compress log file")
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "unable to compress log file")
+	}
+	if err := dst.Close(); err != nil {
+		return errors.Wrap(err, "unable to compress log file")
+	}
+	return errors.Wrap(os.Remove(name), "unable to remove compressed log file")
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,180 @@
+package hdrhist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rotatingTestHist(start time.Time, count int64) *Hist {
+	var h Hist
+	h.Init(testLoggerConfig)
+	h.RecordN(count, count)
+	h.SetStartTime(start)
+	h.SetEndTime(start.Add(time.Second))
+	return &h
+}
+
+// readRotatedLogs reads the files in dir in name order
+// and returns the total count of each histogram by file.
+func readRotatedLogs(t *testing.T, dir string, start time.Time) (names []string, counts [][]int64) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lr, err := OpenLogReader(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c []int64
+		for lr.Scan() {
+			c = append(c, lr.Hist().TotalCount())
+		}
+		if err := lr.Err(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if st, ok := lr.StartTime(); !ok || !st.Equal(start) {
+			t.Errorf("%s: got start time %v, %t, want %v", name, st, ok, start)
+		}
+		if bt, ok := lr.BaseTime(); !ok || !bt.Equal(start) {
+			t.Errorf("%s: got base time %v, %t, want %v", name, bt, ok, start)
+		}
+		if len(lr.Legend()) == 0 {
+			t.Errorf("%s: missing legend", name)
+		}
+		if err := lr.Close(); err != nil {
+			t.Error(err)
+		}
+		counts = append(counts, c)
+	}
+	return names, counts
+}
+
+func TestRotatingLogWriterSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdrhist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Unix(1500000000, 0)
+	w, err := NewRotatingLogWriter(RotatingLogWriterConfig{
+		Path:     filepath.Join(dir, "latency.hlog"),
+		MaxSize:  1,
+		Compress: true,
+		Log:      LogWriterConfig{StartTime: start, BaseTime: start},
+		Clock:    newFakeClock(start),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := w.Write(rotatingTestHist(start.Add(time.Duration(i)*time.Second), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, counts := readRotatedLogs(t, dir, start)
+	want := []string{
+		"latency-20170714T024000.000Z.hlog.gz",
+		"latency-20170714T024000.000Z_001.hlog.gz",
+		"latency-20170714T024000.000Z_002.hlog.gz",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %q, want %q", names, want)
+	}
+	for i, c := range [][]int64{{1}, {2}, {3}} {
+		if len(counts[i]) != 1 || counts[i][0] != c[0] {
+			t.Errorf("%s: got counts %v, want %v", names[i], counts[i], c)
+		}
+	}
+}
+
+func TestRotatingLogWriterAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdrhist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Unix(1500000000, 0)
+	clock := newFakeClock(start)
+	w, err := NewRotatingLogWriter(RotatingLogWriterConfig{
+		Path:   filepath.Join(dir, "latency.hlog"),
+		MaxAge: 10 * time.Second,
+		Log:    LogWriterConfig{StartTime: start, BaseTime: start},
+		Clock:  clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 4; i++ {
+		if err := w.Write(rotatingTestHist(clock.Now(), i)); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(5 * time.Second)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, counts := readRotatedLogs(t, dir, start)
+	want := []string{
+		"latency-20170714T024000.000Z.hlog",
+		"latency-20170714T024010.000Z.hlog",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %q, want %q", names, want)
+	}
+	for i, c := range [][]int64{{1, 2}, {3, 4}} {
+		if len(counts[i]) != 2 || counts[i][0] != c[0] || counts[i][1] != c[1] {
+			t.Errorf("%s: got counts %v, want %v", names[i], counts[i], c)
+		}
+	}
+}
+
+func TestRotatingLogWriterDefaultTimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdrhist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Unix(1500000000, 0)
+	clock := newFakeClock(start)
+	w, err := NewRotatingLogWriter(RotatingLogWriterConfig{
+		Path:    filepath.Join(dir, "latency.hlog"),
+		MaxSize: 1,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		clock.now = clock.now.Add(time.Second)
+		if err := w.Write(rotatingTestHist(clock.Now(), i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every file has the start and base times of the writer's creation
+	names, _ := readRotatedLogs(t, dir, start)
+	if len(names) != 3 {
+		t.Errorf("got files %q, want 3", names)
+	}
+}
@@ -0,0 +1,164 @@
+package hdrhist
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardedRecorder provides the same API as Recorder
+// but spreads recorded values across several Hist shards
+// to avoid contention between goroutines on different cores.
+//
+// Each recording goroutine picks a shard using a per-P hint,
+// so goroutines running on different Ps usually record into different shards.
+// IntervalHist merges all shards into a single Hist.
+//
+// ShardedRecorder is safe for concurrent use.
+// Values recorded concurrently with IntervalHist are included
+// in either the current or the next interval, but are never lost.
+type ShardedRecorder struct {
+	shards []recorderShard
+	hints  sync.Pool // *int shard indices
+	next   uint32    // accessed atomically
+
+	mu        sync.Mutex // serializes IntervalHist, Clear, and tag access
+	startTime time.Time
+	tag       string
+}
+
+type recorderShard struct {
+	mu sync.Mutex
+	h  Hist
+
+	_ [64]byte // keep shards on separate cache lines
+}
+
+// NewShardedRecorder creates a new ShardedRecorder that auto-resizes
+// and has a LowestDiscernible value of 1.
+// Valid values for sigfigs are between 0 and 5.
+func NewShardedRecorder(sigfigs int32) *ShardedRecorder {
+	return NewShardedRecorderWithConfig(Config{
+		LowestDiscernible: 1,
+		HighestTrackable:  2,
+		SigFigs:           sigfigs,
+		AutoResize:        true,
+	})
+}
+
+// NewShardedRecorderWithConfig creates a new ShardedRecorder
+// with the provided Config and one shard per P.
+func NewShardedRecorderWithConfig(cfg Config) *ShardedRecorder {
+	var r ShardedRecorder
+	r.Init(cfg)
+	return &r
+}
+
+// Init initializes the ShardedRecorder with one shard
+// for each P (see runtime.GOMAXPROCS).
+// Init must not be called concurrently with any other method.
+func (r *ShardedRecorder) Init(cfg Config) {
+	r.InitShards(cfg, runtime.GOMAXPROCS(0))
+}
+
+// InitShards initializes the ShardedRecorder with n shards.
+// Init must not be called concurrently with any other method.
+func (r *ShardedRecorder) InitShards(cfg Config, n int) {
+	if n < 1 {
+		panic("invalid shard count: must be >= 1")
+	}
+	r.shards = make([]recorderShard, n)
+	for i := range r.shards {
+		r.shards[i].h.Init(cfg)
+	}
+	r.next = 0
+	r.hints.New = func() interface{} {
+		i := int(atomic.AddUint32(&r.next, 1)-1) % len(r.shards)
+		return &i
+	}
+	r.startTime = time.Now()
+	r.tag = ""
+}
+
+// Clear deletes all recorded values and restarts the current interval.
+func (r *ShardedRecorder) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		s.h.Clear()
+		s.mu.Unlock()
+	}
+	r.startTime = time.Now()
+}
+
+// Tag returns the tag given to interval histograms.
+func (r *ShardedRecorder) Tag() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tag
+}
+
+// SetTag sets the tag given to interval histograms.
+func (r *ShardedRecorder) SetTag(tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tag = tag
+}
+
+func (r *ShardedRecorder) Record(v int64) { r.RecordN(v, 1) }
+
+func (r *ShardedRecorder) RecordN(v, count int64) {
+	hint := r.hints.Get().(*int)
+	defer r.hints.Put(hint)
+	s := &r.shards[*hint]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.h.RecordN(v, count)
+}
+
+func (r *ShardedRecorder) RecordCorrected(v int64, expectedInterval int64) {
+	hint := r.hints.Get().(*int)
+	defer r.hints.Put(hint)
+	s := &r.shards[*hint]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.h.RecordCorrected(v, expectedInterval)
+}
+
+// IntervalHist returns a Hist containing all values recorded
+// since the last call to IntervalHist (or since Init),
+// and resets the ShardedRecorder.
+//
+// If h is non-nil, its memory is reused and h is returned.
+// Otherwise, a new Hist is allocated.
+// The start and end times of the returned Hist
+// are set to the bounds of the interval.
+func (r *ShardedRecorder) IntervalHist(h *Hist) *Hist {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if h == nil {
+		h = &Hist{}
+	}
+	now := time.Now()
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		if i == 0 {
+			h.copyFrom(&s.h)
+		} else {
+			h.Add(&s.h)
+		}
+		s.h.Clear()
+		s.mu.Unlock()
+	}
+	h.SetStartTime(r.startTime)
+	h.SetEndTime(now)
+	h.SetTag(r.tag)
+	r.startTime = now
+	return h
+}
@@ -7,10 +7,6 @@ package hdrhist
 // Keep all uses of unsafe here so that we make sure unsafe
 // is not imported in any of the other files.
 
-import (
-	"reflect"
-	"time"
-)
+import "reflect"
 
 var histSize = int(reflect.TypeOf(Hist{}).Size())
-var timeSize = int(reflect.TypeOf(time.Time{}).Size() + reflect.TypeOf(time.Location{}).Size())
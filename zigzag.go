@@ -103,7 +103,7 @@ func decodeZigZagUnsafe(b []byte) (int64, int) {
 								vlen++
 								value |= (v & 0x7F) << 49
 								if (v & 0x80) != 0 {
-									v = int64(b[9])
+									v = int64(b[8])
 									vlen++
 									value |= v << 56
 								}